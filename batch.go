@@ -0,0 +1,281 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Mutation is a change to a single entry, for ApplyBatch.
+type Mutation struct {
+	Key   interface{}
+	Value interface{}
+	// Delete removes the entry with the key, if present, instead of setting its value.
+	Delete bool
+}
+
+// batchEntry is a mutation along with the layer of the tree its key belongs in.
+type batchEntry struct {
+	Mutation
+	layer uint8
+}
+
+// batchCounts tallies the entries added and removed by a batch.
+type batchCounts struct {
+	added, removed uint64
+}
+
+// ApplyBatch applies the given mutations to the tree. Rather than descending from the root
+// for every key, the mutations are sorted and each subtree is visited once for all the
+// mutations that affect it, which is much faster for large batches than Insert. If the
+// batch has more than one mutation for the same key, the last one wins.
+//
+// Mutations are applied in chunks no bigger than the tree, so that it can grow between them
+// and its nodes stay near the branch factor in size.
+func (m *Mast) ApplyBatch(ctx context.Context, mutations []Mutation) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	entries := make([]batchEntry, len(mutations))
+	for i := range mutations {
+		layer, err := m.keyLayer(mutations[i].Key, m.branchFactor)
+		if err != nil {
+			return fmt.Errorf("layer: %w", err)
+		}
+		entries[i] = batchEntry{mutations[i], layer}
+	}
+	var err error
+	sort.SliceStable(entries, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		var cmp int
+		cmp, err = m.keyOrder(entries[i].Key, entries[j].Key)
+		return cmp < 0
+	})
+	if err != nil {
+		return fmt.Errorf("keyCompare: %w", err)
+	}
+	deduped := entries[:0]
+	for i := range entries {
+		if i+1 < len(entries) {
+			cmp, err := m.keyOrder(entries[i].Key, entries[i+1].Key)
+			if err != nil {
+				return fmt.Errorf("keyCompare: %w", err)
+			}
+			if cmp == 0 {
+				continue
+			}
+		}
+		deduped = append(deduped, entries[i])
+	}
+
+	for len(deduped) > 0 {
+		n := int(m.size)
+		if n < int(m.branchFactor) {
+			n = int(m.branchFactor)
+		}
+		if n > len(deduped) {
+			n = len(deduped)
+		}
+		err = m.applyBatchChunk(ctx, deduped[:n])
+		if err != nil {
+			return err
+		}
+		deduped = deduped[n:]
+	}
+	return nil
+}
+
+// applyBatchChunk applies the given sorted mutations, then grows or shrinks the tree to
+// suit its new size.
+func (m *Mast) applyBatchChunk(ctx context.Context, entries []batchEntry) error {
+	for i := range entries {
+		entries[i].layer = uint8min(entries[i].layer, m.height)
+	}
+	var counts batchCounts
+	newRoot, changed, err := m.applyBatch(ctx, m.root, m.height, entries, &counts)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	m.root = newRoot
+	m.size = m.size + counts.added - counts.removed
+	if m.size == 0 {
+		m.root = nil
+		m.height = 0
+		m.shrinkBelowSize = 1
+		m.growAfterSize = uint64(m.branchFactor)
+		return nil
+	}
+	for counts.added > 0 && m.size > m.growAfterSize {
+		root, err := m.load(ctx, m.root)
+		if err != nil {
+			return fmt.Errorf("load root: %w", err)
+		}
+		canGrow, err := root.canGrow(m.height, m.keyLayer, m.branchFactor)
+		if err != nil {
+			return fmt.Errorf("canGrow: %w", err)
+		}
+		if !canGrow {
+			break
+		}
+		err = m.grow(ctx)
+		if err != nil {
+			return fmt.Errorf("grow: %w", err)
+		}
+	}
+	for m.size < m.shrinkBelowSize && m.height > 0 {
+		err = m.shrink(ctx)
+		if err != nil {
+			return fmt.Errorf("shrink: %w", err)
+		}
+	}
+	return m.noteDirty(ctx, len(entries))
+}
+
+// applyBatch applies the given sorted mutations, whose keys all belong at or below the
+// given height, to the subtree at the given link. It returns the subtree's new link, and
+// whether anything changed, tallying the entries added and removed in the given counts.
+func (m *Mast) applyBatch(
+	ctx context.Context,
+	link interface{},
+	height uint8,
+	entries []batchEntry,
+	counts *batchCounts,
+) (interface{}, bool, error) {
+	var node *mastNode
+	if link == nil {
+		node = emptyNodePointer(int(m.branchFactor))
+	} else {
+		var err error
+		node, err = m.load(ctx, link)
+		if err != nil {
+			return nil, false, fmt.Errorf("load: %w", err)
+		}
+	}
+	changed := false
+	mutate := func() {
+		if !changed {
+			node = node.ToMut(ctx, m)
+			node.Dirty()
+			changed = true
+		}
+	}
+	// first the entries in this node, so that the children are split and merged around
+	// them before descending
+	i := 0
+	for _, e := range entries {
+		if e.layer != height {
+			continue
+		}
+		cmp := 1
+		for ; i < len(node.Key); i++ {
+			var err error
+			cmp, err = m.keyOrder(node.Key[i], e.Key)
+			if err != nil {
+				return nil, false, fmt.Errorf("keyCompare: %w", err)
+			}
+			if cmp >= 0 {
+				break
+			}
+		}
+		switch {
+		case cmp == 0 && e.Delete:
+			mutate()
+			var err error
+			node, err = deleteEntry(ctx, m, node, i)
+			if err != nil {
+				return nil, false, err
+			}
+			counts.removed++
+		case cmp == 0:
+			if !reflect.DeepEqual(node.Value[i], e.Value) {
+				mutate()
+				node.Value[i] = e.Value
+			}
+			i++
+		case e.Delete:
+		default:
+			mutate()
+			var leftLink, rightLink interface{}
+			if node.Link[i] != nil {
+				child, err := m.load(ctx, node.Link[i])
+				if err != nil {
+					return nil, false, err
+				}
+				leftLink, rightLink, err = split(ctx, child, e.Key, m)
+				if err != nil {
+					return nil, false, fmt.Errorf("split: %w", err)
+				}
+			}
+			node.Key = append(node.Key, nil)
+			copy(node.Key[i+1:], node.Key[i:])
+			node.Key[i] = e.Key
+			node.Value = append(node.Value, nil)
+			copy(node.Value[i+1:], node.Value[i:])
+			node.Value[i] = e.Value
+			node.Link = append(node.Link, nil)
+			copy(node.Link[i+1:], node.Link[i:])
+			node.Link[i] = leftLink
+			node.Link[i+1] = rightLink
+			counts.added++
+			i++
+		}
+	}
+
+	// then the entries below, grouped by the child they belong under
+	below := entries[:0]
+	for _, e := range entries {
+		if e.layer != height {
+			below = append(below, e)
+		}
+	}
+	entries = below
+	i = 0
+	for start := 0; start < len(entries); {
+		for ; i < len(node.Key); i++ {
+			cmp, err := m.keyOrder(node.Key[i], entries[start].Key)
+			if err != nil {
+				return nil, false, fmt.Errorf("keyCompare: %w", err)
+			}
+			if cmp > 0 {
+				break
+			}
+		}
+		end := start + 1
+		for ; end < len(entries); end++ {
+			if i == len(node.Key) {
+				end = len(entries)
+				break
+			}
+			cmp, err := m.keyOrder(node.Key[i], entries[end].Key)
+			if err != nil {
+				return nil, false, fmt.Errorf("keyCompare: %w", err)
+			}
+			if cmp <= 0 {
+				break
+			}
+		}
+		childLink, childChanged, err := m.applyBatch(ctx, node.Link[i], height-1, entries[start:end], counts)
+		if err != nil {
+			return nil, false, err
+		}
+		if childChanged {
+			mutate()
+			node.Link[i] = childLink
+		}
+		start = end
+	}
+
+	if !changed {
+		return link, false, nil
+	}
+	if node.isEmpty() {
+		return nil, true, nil
+	}
+	return node, true, nil
+}
@@ -0,0 +1,79 @@
+package mast
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyBatch(t *testing.T) {
+	t.Parallel()
+	store := NewInMemoryStore()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store}
+	batched, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	sequential, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	expected := map[int]int{}
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		var batch []Mutation
+		for i := 0; i < r.Intn(2000); i++ {
+			key := r.Intn(5000)
+			if round > 5 && r.Intn(3) == 0 {
+				batch = append(batch, Mutation{Key: key, Delete: true})
+				delete(expected, key)
+				_, _, err = sequential.DeleteKey(ctx, key)
+				require.NoError(t, err)
+				continue
+			}
+			batch = append(batch, Mutation{Key: key, Value: round})
+			expected[key] = round
+			require.NoError(t, sequential.Insert(ctx, key, round))
+		}
+		require.NoError(t, batched.ApplyBatch(ctx, batch))
+		require.Equal(t, uint64(len(expected)), batched.Size())
+
+		actual := map[int]int{}
+		require.NoError(t, batched.Iter(ctx, func(k, v interface{}) error {
+			actual[k.(int)] = v.(int)
+			return nil
+		}))
+		require.Equal(t, expected, actual)
+
+		batchedRoot, err := batched.MakeRoot(ctx)
+		require.NoError(t, err)
+		report, err := Verify(ctx, batchedRoot, &config)
+		require.NoError(t, err)
+		require.True(t, report.OK(), "%v", report.Problems)
+		require.Equal(t, sequential.Height(), batched.Height(), "round %d", round)
+		sequentialRoot, err := sequential.MakeRoot(ctx)
+		require.NoError(t, err)
+		require.Equal(t, sequentialRoot, batchedRoot, "round %d", round)
+		batched, err = batchedRoot.LoadMast(ctx, &config)
+		require.NoError(t, err)
+	}
+}
+
+func TestApplyBatchLastMutationWins(t *testing.T) {
+	t.Parallel()
+	m := newTestTree(0, 0)
+	require.NoError(t, m.ApplyBatch(ctx, []Mutation{
+		{Key: 1, Value: 1},
+		{Key: 2, Value: 2},
+		{Key: 1, Delete: true},
+		{Key: 2, Value: 3},
+		{Key: 3, Delete: true},
+	}))
+	require.Equal(t, uint64(1), m.Size())
+	var v int
+	found, err := m.Get(ctx, 2, &v)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 3, v)
+
+	require.NoError(t, m.ApplyBatch(ctx, []Mutation{{Key: 2, Delete: true}}))
+	require.Equal(t, uint64(0), m.Size())
+	require.NoError(t, m.ApplyBatch(ctx, nil))
+}
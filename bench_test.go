@@ -81,6 +81,25 @@ func BenchmarkMastGet10k(b *testing.B)  { benchmarkMastGet(10_000, b) }
 func BenchmarkMastGet100k(b *testing.B) { benchmarkMastGet(100_000, b) }
 func BenchmarkMastGet1m(b *testing.B)   { benchmarkMastGet(1_000_000, b) }
 
+func benchmarkMastApplyBatch(factor int, b *testing.B) {
+	m := newTestTree(0, "")
+	b.StopTimer()
+	batch := make([]Mutation, 0, factor*b.N)
+	for n := 0; n < factor*b.N; n++ {
+		batch = append(batch, Mutation{Key: n, Value: n})
+	}
+	b.StartTimer()
+	m.ApplyBatch(context.Background(), batch)
+}
+
+func BenchmarkMastApplyBatch1(b *testing.B)    { benchmarkMastApplyBatch(1, b) }
+func BenchmarkMastApplyBatch10(b *testing.B)   { benchmarkMastApplyBatch(10, b) }
+func BenchmarkMastApplyBatch100(b *testing.B)  { benchmarkMastApplyBatch(100, b) }
+func BenchmarkMastApplyBatch1k(b *testing.B)   { benchmarkMastApplyBatch(1_000, b) }
+func BenchmarkMastApplyBatch10k(b *testing.B)  { benchmarkMastApplyBatch(10_000, b) }
+func BenchmarkMastApplyBatch100k(b *testing.B) { benchmarkMastApplyBatch(100_000, b) }
+func BenchmarkMastApplyBatch1m(b *testing.B)   { benchmarkMastApplyBatch(1_000_000, b) }
+
 func BenchmarkExerciser(b *testing.B) {
 	parameters := gopter.DefaultTestParametersWithSeed(1593228262585360000)
 	parameters.MaxSize = 2048
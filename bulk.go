@@ -0,0 +1,199 @@
+package mast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// BulkLoader builds a persisted tree from entries given in increasing key order, without
+// holding the tree in memory. Each node is stored as soon as it is complete, and the nodes
+// are the same as those made by inserting the entries one at a time, so the result can be
+// diffed efficiently against trees made either way.
+//
+// Only the nodes below the height the tree has reached so far are stored as they fill.
+// Those at or above it, which is at most a few nodes per layer but can be up to a
+// branch factor of keys each, stay in memory until Finish, since until then it isn't
+// known which of them will be merged into the root.
+type BulkLoader struct {
+	m *Mast
+	q *storeQueue
+	// open has the node being filled at each layer.
+	open     []*mastNode
+	maxLayer uint8
+	last     interface{}
+	finished bool
+}
+
+// NewBulkLoader starts building a new tree, to be persisted according to the given
+// config and options.
+func NewBulkLoader(config *RemoteConfig, options *CreateRemoteOptions) (*BulkLoader, error) {
+	m, err := NewRoot(options).newMast(config)
+	if err != nil {
+		return nil, err
+	}
+	if m.persist == nil {
+		return nil, fmt.Errorf("no persistence mechanism set; set RemoteConfig.StoreImmutablePartsWith")
+	}
+	err = m.checkEntryTypes()
+	if err != nil {
+		return nil, err
+	}
+	return &BulkLoader{
+		m: m,
+		q: m.newStoreQueue(nil),
+	}, nil
+}
+
+// ErrBulkLoaderFinished is returned when a BulkLoader is used after Finish.
+var ErrBulkLoaderFinished = errors.New("bulk loader already finished")
+
+// Add adds an entry, whose key must be greater than that of the previous entry.
+func (b *BulkLoader) Add(ctx context.Context, key, value interface{}) error {
+	if b.finished {
+		return ErrBulkLoaderFinished
+	}
+	err := b.q.err()
+	if err != nil {
+		return err
+	}
+	if b.m.size > 0 {
+		cmp, err := b.m.keyOrder(b.last, key)
+		if err != nil {
+			return fmt.Errorf("keyCompare: %w", err)
+		}
+		if cmp >= 0 {
+			return fmt.Errorf("key %v is not greater than previous key %v", key, b.last)
+		}
+	}
+	layer, err := b.m.keyLayer(key, b.m.branchFactor)
+	if err != nil {
+		return fmt.Errorf("layer: %w", err)
+	}
+	for len(b.open) <= int(layer) {
+		b.open = append(b.open, emptyNodePointer(int(b.m.branchFactor)))
+	}
+	if layer > b.maxLayer {
+		b.maxLayer = layer
+	}
+	b.m.size++
+	b.last = key
+
+	// the nodes below the key's layer are complete, and become its left subtree
+	var carry interface{}
+	for l := uint8(0); l < layer; l++ {
+		carry, err = b.complete(ctx, l, carry)
+		if err != nil {
+			return err
+		}
+	}
+	node := b.open[layer]
+	node.Link[len(node.Link)-1] = carry
+	node.Key = append(node.Key, key)
+	node.Value = append(node.Value, value)
+	node.Link = append(node.Link, nil)
+	return nil
+}
+
+// Finish stores the rest of the tree, returning its root. The BulkLoader can't be used
+// afterwards, even if Finish returns an error.
+func (b *BulkLoader) Finish(ctx context.Context) (*Root, error) {
+	if b.finished {
+		return nil, ErrBulkLoaderFinished
+	}
+	b.finished = true
+	if b.m.size == 0 {
+		err := b.q.wait()
+		if err != nil {
+			return nil, err
+		}
+		return b.m.MakeRoot(ctx)
+	}
+	height := b.height()
+	var carry interface{}
+	var err error
+	for l := uint8(0); l < b.maxLayer; l++ {
+		carry, err = b.complete(ctx, l, carry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	top := b.open[b.maxLayer]
+	top.Link[len(top.Link)-1] = carry
+	top.dirty = true
+	root, err := flattenLayers(top, b.maxLayer, height)
+	if err != nil {
+		return nil, err
+	}
+	err = b.q.wait()
+	if err != nil {
+		return nil, err
+	}
+	b.m.root = root
+	b.m.height = height
+	return b.m.MakeRoot(ctx)
+}
+
+// height returns the height the tree would have if its entries so far had been inserted
+// one at a time, which only ever increases as entries are added.
+func (b *BulkLoader) height() uint8 {
+	height := uint8(0)
+	limit := uint64(b.m.branchFactor)
+	for height < b.maxLayer && b.m.size-1 >= limit {
+		height++
+		limit *= uint64(b.m.branchFactor)
+	}
+	return height
+}
+
+// complete finishes the node being filled at the given layer, with the given link as its
+// last, returning the link to it. Nodes that will be below the root are stored right away;
+// the rest are kept until Finish knows the height of the tree.
+func (b *BulkLoader) complete(ctx context.Context, layer uint8, carry interface{}) (interface{}, error) {
+	node := b.open[layer]
+	node.Link[len(node.Link)-1] = carry
+	b.open[layer] = emptyNodePointer(int(b.m.branchFactor))
+	if node.isEmpty() {
+		return nil, nil
+	}
+	node.dirty = true
+	if layer < b.height() {
+		_, err := node.store(ctx, b.m.nodeCache, b.m.nodeMarshaler(), b.m.nodeSizer(), b.q)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// flattenLayers combines the given node, at the given layer, with the unstored nodes below
+// it, down to the given height, into a single root node.
+func flattenLayers(node *mastNode, layer, height uint8) (*mastNode, error) {
+	if layer == height {
+		return node, nil
+	}
+	flattened := emptyNodePointer(cap(node.Key))
+	flattened.Link = flattened.Link[:0]
+	flattened.dirty = true
+	for i, link := range node.Link {
+		switch l := link.(type) {
+		case nil:
+			flattened.Link = append(flattened.Link, nil)
+		case *mastNode:
+			child, err := flattenLayers(l, layer-1, height)
+			if err != nil {
+				return nil, err
+			}
+			flattened.Key = append(flattened.Key, child.Key...)
+			flattened.Value = append(flattened.Value, child.Value...)
+			flattened.Link = append(flattened.Link, child.Link...)
+		default:
+			return nil, fmt.Errorf("unexpected link type %T above the root's layer", l)
+		}
+		if i < len(node.Key) {
+			flattened.Key = append(flattened.Key, node.Key[i])
+			flattened.Value = append(flattened.Value, node.Value[i])
+		}
+	}
+	return flattened, nil
+}
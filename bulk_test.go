@@ -0,0 +1,115 @@
+package mast
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkLoader(t *testing.T) {
+	t.Parallel()
+	for _, nf := range []nodeFormat{V1Marshaler, V115Binary, V115BinaryCounted} {
+		for _, n := range []int{0, 1, 16, 17, 300, 5000} {
+			options := CreateRemoteOptions{NodeFormat: nf}
+			config := RemoteConfig{KeysLike: 1, ValuesLike: "", StoreImmutablePartsWith: NewInMemoryStore()}
+			m, err := NewRoot(&options).LoadMast(ctx, &config)
+			require.NoError(t, err)
+			b, err := NewBulkLoader(&config, &options)
+			require.NoError(t, err)
+			for i := 0; i < n; i++ {
+				require.NoError(t, m.Insert(ctx, i, "v"))
+				require.NoError(t, b.Add(ctx, i, "v"))
+			}
+			expected, err := m.MakeRoot(ctx)
+			require.NoError(t, err)
+			actual, err := b.Finish(ctx)
+			require.NoError(t, err)
+			require.Equal(t, expected, actual, "%s with %d entries", nf, n)
+		}
+	}
+}
+
+func TestBulkLoaderRandomKeys(t *testing.T) {
+	t.Parallel()
+	r := rand.New(rand.NewSource(1))
+	for _, nf := range []nodeFormat{V1Marshaler, V115Binary, V115BinaryCounted} {
+		for _, n := range []int{1, 17, 300, 5000} {
+			seen := map[string]bool{}
+			var keys []string
+			for len(keys) < n {
+				key := fmt.Sprintf("%x", r.Int63())[:1+r.Intn(12)]
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+			options := CreateRemoteOptions{NodeFormat: nf, BranchFactor: 4}
+			config := RemoteConfig{KeysLike: "", ValuesLike: "", StoreImmutablePartsWith: NewInMemoryStore()}
+			m, err := NewRoot(&options).LoadMast(ctx, &config)
+			require.NoError(t, err)
+			for _, key := range keys {
+				require.NoError(t, m.Insert(ctx, key, "v"+key))
+			}
+			expected, err := m.MakeRoot(ctx)
+			require.NoError(t, err)
+
+			sort.Strings(keys)
+			b, err := NewBulkLoader(&config, &options)
+			require.NoError(t, err)
+			for _, key := range keys {
+				require.NoError(t, b.Add(ctx, key, "v"+key))
+			}
+			actual, err := b.Finish(ctx)
+			require.NoError(t, err)
+			require.Equal(t, expected, actual, "%s with %d entries", nf, n)
+		}
+	}
+}
+
+func TestBulkLoaderStreams(t *testing.T) {
+	t.Parallel()
+	store := NewInMemoryStore()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store}
+	b, err := NewBulkLoader(&config, nil)
+	require.NoError(t, err)
+	for i := 0; i < 10_000; i++ {
+		require.NoError(t, b.Add(ctx, i, i))
+	}
+	require.Eventually(t, func() bool {
+		return len(storedNames(t, store)) > 0
+	}, time.Second, time.Millisecond, "nodes should be stored before Finish")
+	root, err := b.Finish(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10_000), root.Size)
+	report, err := Verify(ctx, root, &config)
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Problems)
+	require.Equal(t, uint64(10_000), report.Entries)
+}
+
+func TestBulkLoaderRequiresOrder(t *testing.T) {
+	t.Parallel()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: NewInMemoryStore()}
+	b, err := NewBulkLoader(&config, nil)
+	require.NoError(t, err)
+	require.NoError(t, b.Add(ctx, 2, 2))
+	require.Error(t, b.Add(ctx, 2, 2))
+	require.Error(t, b.Add(ctx, 1, 1))
+}
+
+func TestBulkLoaderFinished(t *testing.T) {
+	t.Parallel()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: NewInMemoryStore()}
+	b, err := NewBulkLoader(&config, nil)
+	require.NoError(t, err)
+	require.NoError(t, b.Add(ctx, 1, 1))
+	_, err = b.Finish(ctx)
+	require.NoError(t, err)
+	require.ErrorIs(t, b.Add(ctx, 2, 2), ErrBulkLoaderFinished)
+	_, err = b.Finish(ctx)
+	require.ErrorIs(t, err, ErrBulkLoaderFinished)
+}
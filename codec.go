@@ -27,12 +27,17 @@ func appendEfaceSlice(buf []byte, l []interface{}, marshal func(interface{}) ([]
 }
 
 func decodeLength(buf []byte, n *int) ([]byte, error) {
-	k, len := binary.Uvarint(buf)
-	if len <= 0 {
+	k, used := binary.Uvarint(buf)
+	if used <= 0 {
+		return nil, errors.New("bad length")
+	}
+	buf = buf[used:]
+	// every length counts bytes, or elements of at least one byte, that follow it
+	if k > uint64(len(buf)) {
 		return nil, errors.New("bad length")
 	}
 	*n = int(k)
-	return buf[len:], nil
+	return buf, nil
 }
 
 func decodeBytes(buf []byte, body *[]byte) ([]byte, error) {
@@ -131,20 +136,71 @@ func marshalMastNode(node *mastNode, marshal func(interface{}) ([]byte, error))
 }
 
 func unmarshalMastNode(m *Mast, buf []byte, node *mastNode) error {
+	_, err := decodeMastNode(m, buf, node)
+	return err
+}
+
+func decodeMastNode(m *Mast, buf []byte, node *mastNode) ([]byte, error) {
 	var err error
 	keyT := reflect.TypeOf(m.zeroKey)
 	buf, err = decodeEfaceSlice(buf, &node.Key, keyT, m.unmarshal)
 	if err != nil {
-		return fmt.Errorf("error when unmarshal node.Key:%s", err)
+		return nil, fmt.Errorf("error when unmarshal node.Key:%s", err)
 	}
 	valueT := reflect.TypeOf(m.zeroValue)
 	buf, err = decodeEfaceSlice(buf, &node.Value, valueT, m.unmarshal)
 	if err != nil {
-		return fmt.Errorf("error when unmarshal node.Value:%s", err)
+		return nil, fmt.Errorf("error when unmarshal node.Value:%s", err)
+	}
+	buf, err = decodeStringSlice(buf, &node.Link)
+	if err != nil {
+		return nil, fmt.Errorf("error when unmarshal node.Link:%s", err)
+	}
+	return buf, nil
+}
+
+// marshalCountedMastNode is like marshalMastNode, followed by the number of entries under
+// each link.
+func marshalCountedMastNode(node *mastNode, marshal func(interface{}) ([]byte, error)) ([]byte, error) {
+	buf, err := marshalMastNode(node, marshal)
+	if err != nil {
+		return nil, err
+	}
+	buf = appendLength(buf, len(node.linkCount))
+	for _, count := range node.linkCount {
+		buf = appendCount(buf, count)
+	}
+	return buf, nil
+}
+
+func appendCount(buf []byte, n uint64) []byte {
+	var tmpbuf [binary.MaxVarintLen64]byte
+	len := binary.PutUvarint(tmpbuf[:], n)
+	return append(buf, tmpbuf[:len]...)
+}
+
+func unmarshalCountedMastNode(m *Mast, buf []byte, node *mastNode) error {
+	buf, err := decodeMastNode(m, buf, node)
+	if err != nil {
+		return err
 	}
-	_, err = decodeStringSlice(buf, &node.Link)
+	var total int
+	buf, err = decodeLength(buf, &total)
 	if err != nil {
-		return fmt.Errorf("error when unmarshal node.Link:%s", err)
+		return fmt.Errorf("error when unmarshal node.linkCount:%s", err)
+	}
+	if total != len(node.Link) {
+		return fmt.Errorf("error when unmarshal node.linkCount: %d counts for %d links", total, len(node.Link))
+	}
+	counts := make([]uint64, total)
+	for i := 0; i < total; i++ {
+		count, len := binary.Uvarint(buf)
+		if len <= 0 {
+			return errors.New("error when unmarshal node.linkCount: bad count")
+		}
+		counts[i] = count
+		buf = buf[len:]
 	}
+	node.linkCount = counts
 	return nil
 }
@@ -0,0 +1,120 @@
+package mast
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// commitNamePrefix distinguishes commits from nodes stored in the same Persist.
+const commitNamePrefix = "commit-"
+
+// Commit records a version of a tree along with where it came from.
+type Commit struct {
+	// Root is the version of the tree.
+	Root Root
+	// Parents has the names of the commits this one was made from, usually one, or more for
+	// merges.
+	Parents []string `json:",omitempty"`
+	// Time is when the commit was made.
+	Time time.Time
+	// Author identifies who made the commit.
+	Author string `json:",omitempty"`
+	// Message describes the commit.
+	Message string `json:",omitempty"`
+	// Metadata has any other information about the commit.
+	Metadata map[string]string `json:",omitempty"`
+}
+
+// StoreCommit persists the given commit, returning the name it can be loaded by. Like
+// nodes, commits are named by their content, so storing equal commits yields the same name.
+func StoreCommit(ctx context.Context, persist Persist, c *Commit) (string, error) {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("marshal: %w", err)
+	}
+	name := commitNamePrefix + hashNode(encoded)
+	err = persist.Store(ctx, name, encoded)
+	if err != nil {
+		return "", fmt.Errorf("persist store: %w", err)
+	}
+	return name, nil
+}
+
+// LoadCommit loads the commit with the given name.
+func LoadCommit(ctx context.Context, persist Persist, name string) (*Commit, error) {
+	encoded, err := persist.Load(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("persist load %s: %w", name, err)
+	}
+	var c Commit
+	err = json.Unmarshal(encoded, &c)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", name, err)
+	}
+	return &c, nil
+}
+
+// LoadMast loads the version of the tree recorded in the commit.
+func (c *Commit) LoadMast(ctx context.Context, config *RemoteConfig) (*Mast, error) {
+	return c.Root.LoadMast(ctx, config)
+}
+
+// Log visits the named commit and its ancestors, newest first, invoking the given callback
+// with each commit's name. Every commit is visited once, even if reachable by more than
+// one path. Returning ErrIterDone from the callback stops the walk early.
+func Log(ctx context.Context, persist Persist, name string, f func(string, *Commit) error) error {
+	c, err := LoadCommit(ctx, persist, name)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{name: true}
+	queue := &commitQueue{{name, c}}
+	for queue.Len() > 0 {
+		next := heap.Pop(queue).(namedCommit)
+		err = f(next.name, next.commit)
+		if err == ErrIterDone {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, parent := range next.commit.Parents {
+			if seen[parent] {
+				continue
+			}
+			seen[parent] = true
+			c, err := LoadCommit(ctx, persist, parent)
+			if err != nil {
+				return err
+			}
+			heap.Push(queue, namedCommit{parent, c})
+		}
+	}
+	return nil
+}
+
+type namedCommit struct {
+	name   string
+	commit *Commit
+}
+
+// commitQueue is a heap of commits, newest first.
+type commitQueue []namedCommit
+
+func (q commitQueue) Len() int           { return len(q) }
+func (q commitQueue) Less(i, j int) bool { return q[i].commit.Time.After(q[j].commit.Time) }
+func (q commitQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *commitQueue) Push(x interface{}) {
+	*q = append(*q, x.(namedCommit))
+}
+
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	res := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return res
+}
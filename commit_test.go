@@ -0,0 +1,96 @@
+package mast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitLog(t *testing.T) {
+	t.Parallel()
+	store := NewInMemoryStore()
+	config := RemoteConfig{
+		KeysLike:                "",
+		ValuesLike:              "",
+		StoreImmutablePartsWith: store,
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	commit := func(m *Mast, parents []string, minutes int, message string) string {
+		root, err := m.MakeRoot(ctx)
+		require.NoError(t, err)
+		name, err := StoreCommit(ctx, store, &Commit{
+			Root:     *root,
+			Parents:  parents,
+			Time:     start.Add(time.Duration(minutes) * time.Minute),
+			Author:   "tester",
+			Message:  message,
+			Metadata: map[string]string{"ticket": message},
+		})
+		require.NoError(t, err)
+		return name
+	}
+	m, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	require.NoError(t, m.Insert(ctx, "greeting", "hello"))
+	first := commit(m, nil, 0, "first")
+
+	left, err := m.Clone(ctx)
+	require.NoError(t, err)
+	require.NoError(t, left.Insert(ctx, "greeting", "hi"))
+	leftName := commit(&left, []string{first}, 1, "left")
+
+	right, err := m.Clone(ctx)
+	require.NoError(t, err)
+	require.NoError(t, right.Insert(ctx, "farewell", "bye"))
+	rightName := commit(&right, []string{first}, 2, "right")
+
+	merged, err := left.Clone(ctx)
+	require.NoError(t, err)
+	require.NoError(t, merged.Insert(ctx, "farewell", "bye"))
+	head := commit(&merged, []string{leftName, rightName}, 3, "merge")
+
+	again := commit(&merged, []string{leftName, rightName}, 3, "merge")
+	require.Equal(t, head, again)
+
+	var messages []string
+	require.NoError(t, Log(ctx, store, head, func(name string, c *Commit) error {
+		messages = append(messages, c.Message)
+		require.Equal(t, "tester", c.Author)
+		require.Equal(t, c.Message, c.Metadata["ticket"])
+		return nil
+	}))
+	require.Equal(t, []string{"merge", "right", "left", "first"}, messages)
+
+	messages = nil
+	require.NoError(t, Log(ctx, store, head, func(name string, c *Commit) error {
+		if len(messages) == 2 {
+			return ErrIterDone
+		}
+		messages = append(messages, c.Message)
+		return nil
+	}))
+	require.Equal(t, []string{"merge", "right"}, messages)
+
+	// time travel
+	c, err := LoadCommit(ctx, store, first)
+	require.NoError(t, err)
+	old, err := c.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	var greeting string
+	found, err := old.Get(ctx, "greeting", &greeting)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "hello", greeting)
+
+	// history is kept by garbage collection
+	result, err := CollectGarbage(ctx, &config, nil, GCOptions{Commits: []string{head}})
+	require.NoError(t, err)
+	require.Empty(t, result.Collected)
+	old, err = c.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	found, err = old.Get(ctx, "greeting", &greeting)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "hello", greeting)
+}
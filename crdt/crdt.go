@@ -0,0 +1,213 @@
+/*
+Package crdt provides a last-writer-wins map, a state-based CRDT, on top of a Mast.
+
+Every value carries the time it was written and the ID of the replica that wrote it, and
+deleted entries are kept as tombstones, so that replicas that made concurrent changes can be
+combined with Join, in any order, and converge to the same tree. Since equal subtrees have
+equal hashes, joining replicas that mostly agree only visits the parts that differ.
+*/
+package crdt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jrhy/mast"
+)
+
+// Entry is how a Map stores a value, along with what is needed to merge concurrent writes.
+type Entry[V any] struct {
+	Value V `json:",omitempty"`
+	// Timestamp orders writes to the same key; the latest wins.
+	Timestamp int64
+	// Replica identifies the writer, breaking ties between equal timestamps.
+	Replica string
+	// Deleted marks a tombstone, which records that the entry was deleted.
+	Deleted bool `json:",omitempty"`
+}
+
+// wins indicates e should replace other when merging.
+func (e Entry[V]) wins(other Entry[V]) bool {
+	if e.Timestamp != other.Timestamp {
+		return e.Timestamp > other.Timestamp
+	}
+	if e.Replica != other.Replica {
+		return e.Replica > other.Replica
+	}
+	if e.Deleted != other.Deleted {
+		return e.Deleted
+	}
+	// only reachable if a replica reuses a timestamp; stay deterministic anyway
+	ej, _ := json.Marshal(e.Value)
+	oj, _ := json.Marshal(other.Value)
+	return bytes.Compare(ej, oj) > 0
+}
+
+// Map is a last-writer-wins map whose replicas can be joined.
+type Map[K, V any] struct {
+	t       *mast.Typed[K, Entry[V]]
+	replica string
+	// Clock returns the timestamp for new writes; defaults to time.Now().UnixNano(). Writes
+	// are always given timestamps after that of the entry they replace.
+	Clock func() int64
+}
+
+// New returns a Map for the given tree, whose writes will be attributed to the given replica.
+func New[K, V any](t *mast.Typed[K, Entry[V]], replica string) *Map[K, V] {
+	return &Map[K, V]{
+		t:       t,
+		replica: replica,
+		Clock:   func() int64 { return time.Now().UnixNano() },
+	}
+}
+
+// NewInMemory returns an empty Map for use as an in-memory data structure.
+func NewInMemory[K, V any](replica string) *Map[K, V] {
+	return New(mast.NewTypedInMemory[K, Entry[V]](), replica)
+}
+
+// Load loads a Map from a remote store, like mast.LoadTyped.
+func Load[K, V any](ctx context.Context, root *mast.Root, config *mast.RemoteConfig, replica string) (*Map[K, V], error) {
+	t, err := mast.LoadTyped[K, Entry[V]](ctx, root, config)
+	if err != nil {
+		return nil, err
+	}
+	return New(t, replica), nil
+}
+
+// Typed returns the underlying tree, including tombstones.
+func (m *Map[K, V]) Typed() *mast.Typed[K, Entry[V]] {
+	return m.t
+}
+
+// Replica returns the ID that the Map attributes its writes to.
+func (m *Map[K, V]) Replica() string {
+	return m.replica
+}
+
+// Get returns the value for the given key, or !ok if it is absent or deleted.
+func (m *Map[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	var zero V
+	e, ok, err := m.t.Get(ctx, key)
+	if err != nil || !ok || e.Deleted {
+		return zero, false, err
+	}
+	return e.Value, true, nil
+}
+
+// Put sets the value for the given key.
+func (m *Map[K, V]) Put(ctx context.Context, key K, value V) error {
+	return m.write(ctx, key, Entry[V]{Value: value})
+}
+
+// Delete deletes the given key, leaving a tombstone so that the deletion wins over earlier
+// writes when joined with other replicas.
+func (m *Map[K, V]) Delete(ctx context.Context, key K) error {
+	return m.write(ctx, key, Entry[V]{Deleted: true})
+}
+
+func (m *Map[K, V]) write(ctx context.Context, key K, e Entry[V]) error {
+	e.Timestamp = m.Clock()
+	e.Replica = m.replica
+	old, ok, err := m.t.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if ok && old.Timestamp >= e.Timestamp {
+		e.Timestamp = old.Timestamp + 1
+	}
+	return m.t.Insert(ctx, key, e)
+}
+
+// Iter invokes the given callback for every key and value, skipping tombstones.
+func (m *Map[K, V]) Iter(ctx context.Context, f func(K, V) error) error {
+	return m.t.Iter(ctx, func(key K, e Entry[V]) error {
+		if e.Deleted {
+			return nil
+		}
+		return f(key, e.Value)
+	})
+}
+
+// Join merges the entries of the other replica into this one, keeping the winning entry for
+// each key. Joining is commutative, associative and idempotent, so replicas that have joined
+// the same changes, in any order, have the same contents and root hash.
+func (m *Map[K, V]) Join(ctx context.Context, other *Map[K, V]) error {
+	base, err := m.t.Clone(ctx)
+	if err != nil {
+		return fmt.Errorf("clone: %w", err)
+	}
+	return other.t.DiffIter(ctx, base,
+		func(added, removed bool, key K, theirs, ours Entry[V]) (bool, error) {
+			if removed {
+				// only we have it
+				return true, nil
+			}
+			if !added && !theirs.wins(ours) {
+				return true, nil
+			}
+			err := m.t.Insert(ctx, key, theirs)
+			if err != nil {
+				return false, fmt.Errorf("insert: %w", err)
+			}
+			return true, nil
+		})
+}
+
+// Join returns a new Map with the entries of both replicas, attributed to a's replica.
+func Join[K, V any](ctx context.Context, a, b *Map[K, V]) (*Map[K, V], error) {
+	t, err := a.t.Clone(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("clone: %w", err)
+	}
+	res := New(t, a.replica)
+	res.Clock = a.Clock
+	err = res.Join(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Compact removes the tombstones that are also in the given version, returning how many were
+// removed. The version must have been joined by every replica, so that none of them still
+// has a write the tombstones are needed to override; otherwise deleted entries could come
+// back.
+//
+// Every replica must then compact with the same version. Until they all have, joining a
+// replica that hasn't brings its tombstones back; the entries stay deleted, but the space
+// isn't reclaimed.
+func (m *Map[K, V]) Compact(ctx context.Context, acknowledged *Map[K, V]) (int, error) {
+	var keys []K
+	err := m.t.Iter(ctx, func(key K, e Entry[V]) error {
+		if !e.Deleted {
+			return nil
+		}
+		ack, ok, err := acknowledged.t.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("get acknowledged: %w", err)
+		}
+		if ok && ack.Deleted && ack.Timestamp == e.Timestamp && ack.Replica == e.Replica {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, key := range keys {
+		_, _, err = m.t.DeleteKey(ctx, key)
+		if err != nil {
+			return i, fmt.Errorf("delete: %w", err)
+		}
+	}
+	return len(keys), nil
+}
+
+// MakeRoot persists the Map, like mast.Mast.MakeRoot.
+func (m *Map[K, V]) MakeRoot(ctx context.Context) (*mast.Root, error) {
+	return m.t.MakeRoot(ctx)
+}
@@ -0,0 +1,185 @@
+package crdt
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jrhy/mast"
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/arbitrary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+type op struct {
+	Replica uint8
+	Key     uint8
+	Value   int
+	Delete  bool
+}
+
+func newReplicas(t *testing.T, store mast.Persist, n int) []*Map[string, int] {
+	config := mast.RemoteConfig{StoreImmutablePartsWith: store}
+	replicas := make([]*Map[string, int], n)
+	for i := range replicas {
+		m, err := Load[string, int](ctx, mast.NewRoot(nil), &config, fmt.Sprintf("r%d", i))
+		require.NoError(t, err)
+		clock := int64(0)
+		// coarse clocks make ties likely
+		m.Clock = func() int64 { clock++; return clock / 3 }
+		replicas[i] = m
+	}
+	return replicas
+}
+
+func contents(t *testing.T, m *Map[string, int]) map[string]int {
+	res := map[string]int{}
+	require.NoError(t, m.Iter(ctx, func(k string, v int) error {
+		res[k] = v
+		return nil
+	}))
+	return res
+}
+
+func TestJoinConverges(t *testing.T) {
+	t.Parallel()
+	properties := gopter.NewProperties(gopter.DefaultTestParameters())
+	arbitraries := arbitrary.DefaultArbitraries()
+	properties.Property("joining in any order converges",
+		arbitraries.ForAll(
+			func(ops []op) bool {
+				store := mast.NewInMemoryStore()
+				r := newReplicas(t, store, 3)
+				for _, o := range ops {
+					m := r[int(o.Replica)%len(r)]
+					key := fmt.Sprintf("k%d", o.Key%20)
+					if o.Delete {
+						require.NoError(t, m.Delete(ctx, key))
+					} else {
+						require.NoError(t, m.Put(ctx, key, o.Value))
+					}
+				}
+				ab, err := Join(ctx, r[0], r[1])
+				require.NoError(t, err)
+				abc, err := Join(ctx, ab, r[2])
+				require.NoError(t, err)
+				cb, err := Join(ctx, r[2], r[1])
+				require.NoError(t, err)
+				cba, err := Join(ctx, cb, r[0])
+				require.NoError(t, err)
+				again, err := Join(ctx, abc, cba)
+				require.NoError(t, err)
+
+				abcRoot, err := abc.MakeRoot(ctx)
+				require.NoError(t, err)
+				cbaRoot, err := cba.MakeRoot(ctx)
+				require.NoError(t, err)
+				againRoot, err := again.MakeRoot(ctx)
+				require.NoError(t, err)
+				return assert.True(t, abcRoot.Equal(cbaRoot)) &&
+					assert.True(t, abcRoot.Equal(againRoot)) &&
+					assert.Equal(t, contents(t, abc), contents(t, cba))
+			}))
+	properties.TestingRun(t)
+}
+
+func TestLastWriterWins(t *testing.T) {
+	t.Parallel()
+	r := newReplicas(t, mast.NewInMemoryStore(), 2)
+	require.NoError(t, r[0].Put(ctx, "a", 1))
+	require.NoError(t, r[1].Join(ctx, r[0]))
+	require.NoError(t, r[1].Delete(ctx, "a"))
+	require.NoError(t, r[1].Put(ctx, "b", 2))
+	require.NoError(t, r[0].Put(ctx, "b", 3))
+	require.NoError(t, r[0].Put(ctx, "b", 4))
+
+	require.NoError(t, r[0].Join(ctx, r[1]))
+	_, ok, err := r[0].Get(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, ok)
+	v, ok, err := r[0].Get(ctx, "b")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 4, v)
+	require.Equal(t, map[string]int{"b": 4}, contents(t, r[0]))
+}
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+	r := newReplicas(t, mast.NewInMemoryStore(), 2)
+	require.NoError(t, r[0].Put(ctx, "a", 1))
+	require.NoError(t, r[0].Put(ctx, "b", 2))
+	require.NoError(t, r[0].Delete(ctx, "a"))
+	require.NoError(t, r[1].Join(ctx, r[0]))
+	acknowledged, err := Join(ctx, r[0], r[1])
+	require.NoError(t, err)
+
+	// a later tombstone isn't acknowledged yet
+	require.NoError(t, r[0].Delete(ctx, "b"))
+	removed, err := r[0].Compact(ctx, acknowledged)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.Equal(t, uint64(1), r[0].Typed().Size())
+	_, ok, err := r[0].Typed().Get(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// the replicas still agree
+	_, err = r[1].Compact(ctx, acknowledged)
+	require.NoError(t, err)
+	require.NoError(t, r[0].Join(ctx, r[1]))
+	require.NoError(t, r[1].Join(ctx, r[0]))
+	require.Equal(t, contents(t, r[0]), contents(t, r[1]))
+	require.Empty(t, contents(t, r[0]))
+}
+
+func TestCompactNeedsEveryReplica(t *testing.T) {
+	t.Parallel()
+	r := newReplicas(t, mast.NewInMemoryStore(), 3)
+	require.NoError(t, r[0].Put(ctx, "a", 1))
+	require.NoError(t, r[0].Put(ctx, "b", 2))
+	require.NoError(t, r[1].Join(ctx, r[0]))
+	require.NoError(t, r[2].Join(ctx, r[0]))
+	require.NoError(t, r[0].Delete(ctx, "a"))
+	require.NoError(t, r[1].Join(ctx, r[0]))
+
+	// r[2] hasn't seen the deletion, so compacting it away lets "a" come back
+	acknowledged, err := Join(ctx, r[0], r[1])
+	require.NoError(t, err)
+	compacted, err := Join(ctx, r[0], r[1])
+	require.NoError(t, err)
+	removed, err := compacted.Compact(ctx, acknowledged)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.NoError(t, compacted.Join(ctx, r[2]))
+	require.Equal(t, map[string]int{"a": 1, "b": 2}, contents(t, compacted))
+
+	// once every replica has seen it, the entry stays deleted, but a replica that hasn't
+	// compacted brings back its tombstone
+	require.NoError(t, r[2].Join(ctx, r[0]))
+	acknowledged, err = Join(ctx, r[0], r[1])
+	require.NoError(t, err)
+	acknowledged, err = Join(ctx, acknowledged, r[2])
+	require.NoError(t, err)
+	removed, err = r[0].Compact(ctx, acknowledged)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.Equal(t, uint64(1), r[0].Typed().Size())
+	require.NoError(t, r[0].Join(ctx, r[1]))
+	require.Equal(t, map[string]int{"b": 2}, contents(t, r[0]))
+	require.Equal(t, uint64(2), r[0].Typed().Size())
+
+	for _, m := range r {
+		_, err = m.Compact(ctx, acknowledged)
+		require.NoError(t, err)
+	}
+	for _, m := range r {
+		for _, other := range r {
+			require.NoError(t, m.Join(ctx, other))
+		}
+		require.Equal(t, uint64(1), m.Typed().Size())
+	}
+}
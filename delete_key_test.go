@@ -0,0 +1,131 @@
+package mast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteKey(t *testing.T) {
+	t.Parallel()
+	m := newTestTree(0, []string{})
+	for i := 0; i < 100; i++ {
+		require.NoError(t, m.Insert(ctx, i, []string{"value", string(rune('a' + i%26))}))
+	}
+	existed, old, err := m.DeleteKey(ctx, 7)
+	require.NoError(t, err)
+	require.True(t, existed)
+	require.Equal(t, []string{"value", "h"}, old)
+	found, err := m.Get(ctx, 7, nil)
+	require.NoError(t, err)
+	require.False(t, found)
+	require.Equal(t, uint64(99), m.Size())
+
+	existed, old, err = m.DeleteKey(ctx, 7)
+	require.NoError(t, err)
+	require.False(t, existed)
+	require.Nil(t, old)
+
+	for i := 0; i < 100; i++ {
+		_, _, err = m.DeleteKey(ctx, i)
+		require.NoError(t, err)
+	}
+	require.Equal(t, uint64(0), m.Size())
+	existed, _, err = m.DeleteKey(ctx, 7)
+	require.NoError(t, err)
+	require.False(t, existed)
+}
+
+func TestDeleteIf(t *testing.T) {
+	t.Parallel()
+	m := newTestTree(0, map[string]int{})
+	require.NoError(t, m.Insert(ctx, 1, map[string]int{"n": 1}))
+	require.NoError(t, m.Insert(ctx, 2, map[string]int{"n": 2}))
+	even := func(v interface{}) bool { return v.(map[string]int)["n"]%2 == 0 }
+
+	deleted, err := m.DeleteIf(ctx, 1, even)
+	require.NoError(t, err)
+	require.False(t, deleted)
+	deleted, err = m.DeleteIf(ctx, 2, even)
+	require.NoError(t, err)
+	require.True(t, deleted)
+	deleted, err = m.DeleteIf(ctx, 3, even)
+	require.NoError(t, err)
+	require.False(t, deleted)
+	require.Equal(t, uint64(1), m.Size())
+}
+
+func TestConditionalInsert(t *testing.T) {
+	t.Parallel()
+	m := newTestTree(0, []int{})
+
+	added, err := m.InsertIfAbsent(ctx, 1, []int{1})
+	require.NoError(t, err)
+	require.True(t, added)
+	added, err = m.InsertIfAbsent(ctx, 1, []int{2})
+	require.NoError(t, err)
+	require.False(t, added)
+
+	replaced, old, err := m.Replace(ctx, 2, []int{2})
+	require.NoError(t, err)
+	require.False(t, replaced)
+	require.Nil(t, old)
+	replaced, old, err = m.Replace(ctx, 1, []int{3})
+	require.NoError(t, err)
+	require.True(t, replaced)
+	require.Equal(t, []int{1}, old)
+
+	set, err := m.CompareAndSet(ctx, 1, []int{1}, []int{4})
+	require.NoError(t, err)
+	require.False(t, set)
+	set, err = m.CompareAndSet(ctx, 1, []int{3}, []int{4})
+	require.NoError(t, err)
+	require.True(t, set)
+	set, err = m.CompareAndSet(ctx, 2, []int{3}, []int{4})
+	require.NoError(t, err)
+	require.False(t, set)
+
+	var v []int
+	found, err := m.Get(ctx, 1, &v)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, []int{4}, v)
+	require.Equal(t, uint64(1), m.Size())
+}
+
+func TestTypedDeleteKey(t *testing.T) {
+	t.Parallel()
+	type user struct {
+		Name   string
+		Groups []string
+	}
+	m := NewTypedInMemory[string, user]()
+	require.NoError(t, m.Insert(ctx, "alice", user{"Alice", []string{"admin"}}))
+	require.NoError(t, m.Insert(ctx, "bob", user{"Bob", nil}))
+
+	added, err := m.InsertIfAbsent(ctx, "bob", user{"Robert", nil})
+	require.NoError(t, err)
+	require.False(t, added)
+
+	replaced, old, err := m.Replace(ctx, "bob", user{"Robert", nil})
+	require.NoError(t, err)
+	require.True(t, replaced)
+	require.Equal(t, user{"Bob", nil}, old)
+
+	set, err := m.CompareAndSet(ctx, "alice", user{"Alice", []string{"admin"}}, user{"Alice", nil})
+	require.NoError(t, err)
+	require.True(t, set)
+
+	deleted, err := m.DeleteIf(ctx, "alice", func(u user) bool { return len(u.Groups) > 0 })
+	require.NoError(t, err)
+	require.False(t, deleted)
+
+	existed, old, err := m.DeleteKey(ctx, "alice")
+	require.NoError(t, err)
+	require.True(t, existed)
+	require.Equal(t, user{"Alice", nil}, old)
+	existed, old, err = m.DeleteKey(ctx, "alice")
+	require.NoError(t, err)
+	require.False(t, existed)
+	require.Equal(t, user{}, old)
+}
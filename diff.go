@@ -129,7 +129,11 @@ func (m *Mast) diffOne(
 			if err != nil {
 				return fmt.Errorf("load: %w", err)
 			}
-			dc.newStack.pushNode(newNode)
+			m.prefetchLinks(ctx, newNode, nil)
+			err = dc.newStack.pushNode(m, newNode)
+			if err != nil {
+				return fmt.Errorf("push: %w", err)
+			}
 		} else {
 			dc.curKey = n.yield.Key
 			dc.addedValue = n.yield.Value
@@ -144,7 +148,11 @@ func (m *Mast) diffOne(
 			if err != nil {
 				return fmt.Errorf("load: %w", err)
 			}
-			dc.oldStack.pushNode(oldNode)
+			dc.oldMast.prefetchLinks(ctx, oldNode, nil)
+			err = dc.oldStack.pushNode(m, oldNode)
+			if err != nil {
+				return fmt.Errorf("push: %w", err)
+			}
 		} else {
 			dc.curKey = o.yield.Key
 			dc.removedValue = o.yield.Value
@@ -187,6 +195,8 @@ func (m *Mast) diffOne(
 					}
 					return nil
 				}
+				dc.oldMast.prefetchLinks(ctx, oldNode, newNode)
+				m.prefetchLinks(ctx, newNode, oldNode)
 				newKey := newNode.Key[0]
 				cmp, err := m.keyOrder(oldKey, newKey)
 				if err != nil {
@@ -196,14 +206,26 @@ func (m *Mast) diffOne(
 					fmt.Printf("  oldKey=%v.compare(newKey=%v): %d\n", oldKey, newKey, cmp)
 				}
 				if cmp < 0 {
-					dc.oldStack.pushNode(oldNode)
+					err = dc.oldStack.pushNode(m, oldNode)
+					if err != nil {
+						return fmt.Errorf("push: %w", err)
+					}
 					dc.newStack.push(n)
 				} else if cmp > 0 {
 					dc.oldStack.push(o)
-					dc.newStack.pushNode(newNode)
+					err = dc.newStack.pushNode(m, newNode)
+					if err != nil {
+						return fmt.Errorf("push: %w", err)
+					}
 				} else {
-					dc.oldStack.pushNode(oldNode)
-					dc.newStack.pushNode(newNode)
+					err = dc.oldStack.pushNode(m, oldNode)
+					if err != nil {
+						return fmt.Errorf("push: %w", err)
+					}
+					err = dc.newStack.pushNode(m, newNode)
+					if err != nil {
+						return fmt.Errorf("push: %w", err)
+					}
 				}
 			}
 		} else if o.considerLink != nil && n.considerLink == nil {
@@ -214,7 +236,11 @@ func (m *Mast) diffOne(
 			if err != nil {
 				return fmt.Errorf("load: %w", err)
 			}
-			dc.oldStack.pushNode(oldNode)
+			dc.oldMast.prefetchLinks(ctx, oldNode, nil)
+			err = dc.oldStack.pushNode(m, oldNode)
+			if err != nil {
+				return fmt.Errorf("push: %w", err)
+			}
 			dc.newStack.push(n)
 		} else if o.considerLink == nil && n.considerLink != nil {
 			if !m.alreadyNotified(ctx, "new", dc.alreadyNotifiedNewLink, n.considerLink) {
@@ -224,8 +250,12 @@ func (m *Mast) diffOne(
 			if err != nil {
 				return fmt.Errorf("load: %w", err)
 			}
+			m.prefetchLinks(ctx, newNode, nil)
 			dc.oldStack.push(o)
-			dc.newStack.pushNode(newNode)
+			err = dc.newStack.pushNode(m, newNode)
+			if err != nil {
+				return fmt.Errorf("push: %w", err)
+			}
 		} else {
 			// both yields
 			cmp, err := m.keyOrder(o.yield.Key, n.yield.Key)
@@ -294,11 +324,12 @@ func (m *Mast) alreadyNotified(ctx context.Context, name string, linkByHeight ma
 
 type iterItemStack struct {
 	things []iterItem
+	bounds *keyRange
 }
 
 func newIterItemStack(item iterItem) iterItemStack {
 	return iterItemStack{
-		[]iterItem{item},
+		things: []iterItem{item},
 	}
 }
 
@@ -311,13 +342,52 @@ func (stack *iterItemStack) pop() *iterItem {
 	return nil
 }
 
-func (stack *iterItemStack) pushNode(node *mastNode) {
-	for n := range node.Key {
-		i := len(node.Key) - n
-		stack.pushLink(node.Link[i])
-		stack.pushYield(node, i-1)
+// pushNode pushes the node's links and entries, skipping those outside the stack's bounds.
+func (stack *iterItemStack) pushNode(m *Mast, node *mastNode) error {
+	if stack.bounds == nil {
+		for n := range node.Key {
+			i := len(node.Key) - n
+			stack.pushLink(node.Link[i])
+			stack.pushYield(node, i-1)
+		}
+		stack.pushLink(node.Link[0])
+		return nil
+	}
+	r := stack.bounds
+	for i := len(node.Link) - 1; i >= 0; i-- {
+		below, err := r.linkBelow(m, node, i)
+		if err != nil {
+			return err
+		}
+		if below {
+			return nil
+		}
+		above, err := r.linkAbove(m, node, i)
+		if err != nil {
+			return err
+		}
+		if !above {
+			stack.pushLink(node.Link[i])
+		}
+		if i == 0 {
+			break
+		}
+		below, err = r.below(m, node.Key[i-1])
+		if err != nil {
+			return err
+		}
+		if below {
+			return nil
+		}
+		above, err = r.above(m, node.Key[i-1])
+		if err != nil {
+			return err
+		}
+		if !above {
+			stack.pushYield(node, i-1)
+		}
 	}
-	stack.pushLink(node.Link[0])
+	return nil
 }
 
 func (stack *iterItemStack) pushLink(link interface{}) {
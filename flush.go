@@ -0,0 +1,176 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultFlushConcurrency is how many nodes are stored at once, unless told otherwise.
+const DefaultFlushConcurrency = 40
+
+// RateLimiter limits how quickly nodes are stored. The Limiter in golang.org/x/time/rate
+// implements it.
+type RateLimiter interface {
+	// Wait blocks until another node may be stored.
+	Wait(ctx context.Context) error
+}
+
+// FlushOptions controls how nodes are written to the Persist.
+type FlushOptions struct {
+	// Concurrency is how many nodes may be stored at once. 0 means use
+	// DefaultFlushConcurrency.
+	Concurrency int
+	// Retries is how many more times storing a node is tried after it fails.
+	Retries int
+	// Backoff is how long to wait after a node's first failed store; it doubles after each
+	// one.
+	Backoff time.Duration
+	// RateLimiter, if set, is waited on before each store.
+	RateLimiter RateLimiter
+}
+
+// storeRequest is a serialized node to be stored, with a function to call once it has been.
+type storeRequest struct {
+	ctx     context.Context
+	name    string
+	encoded []byte
+	stored  func()
+}
+
+// storeQueue stores the nodes sent to it concurrently, up to a limit. After a store fails,
+// the rest are skipped. Failed and skipped stores are kept as pending, so that they can be
+// tried again by the next flush, without needing the nodes to be serialized again.
+type storeQueue struct {
+	persist  Persist
+	options  FlushOptions
+	ch       chan storeRequest
+	wg       sync.WaitGroup
+	l        sync.Mutex
+	firstErr error
+	pending  map[string][]byte
+}
+
+// newStoreQueue starts storing nodes to the tree's Persist.
+func (m *Mast) newStoreQueue(options *FlushOptions) *storeQueue {
+	if options == nil {
+		options = m.flushOptions
+	}
+	if options == nil {
+		options = &FlushOptions{}
+	}
+	if m.pendingStores == nil {
+		m.pendingStores = map[string][]byte{}
+	}
+	q := &storeQueue{
+		persist: statsPersist{m.persist, &m.flushStats},
+		options: *options,
+		ch:      make(chan storeRequest),
+		pending: m.pendingStores,
+	}
+	n := q.options.Concurrency
+	if n == 0 {
+		n = DefaultFlushConcurrency
+	}
+	gate := make(chan interface{}, n)
+	for i := 0; i < n; i++ {
+		gate <- nil
+	}
+	q.wg.Add(1)
+	go func() {
+		for r := range q.ch {
+			<-gate
+			q.wg.Add(1)
+			go func(r storeRequest) {
+				defer q.wg.Done()
+				defer func() { gate <- nil }()
+				q.run(r)
+			}(r)
+		}
+		q.wg.Done()
+	}()
+	return q
+}
+
+// resume queues the stores that are pending from an earlier flush.
+func (q *storeQueue) resume(ctx context.Context) {
+	q.l.Lock()
+	resumed := make(map[string][]byte, len(q.pending))
+	for name, encoded := range q.pending {
+		resumed[name] = encoded
+		delete(q.pending, name)
+	}
+	q.l.Unlock()
+	for name, encoded := range resumed {
+		q.store(ctx, name, encoded, nil)
+	}
+}
+
+// store queues the given serialized node to be stored, invoking the given function, if
+// any, once it has been.
+func (q *storeQueue) store(ctx context.Context, name string, encoded []byte, stored func()) {
+	q.ch <- storeRequest{ctx, name, encoded, stored}
+}
+
+func (q *storeQueue) run(r storeRequest) {
+	if q.err() == nil {
+		err := q.storeWithRetries(r)
+		if err == nil {
+			if r.stored != nil {
+				r.stored()
+			}
+			return
+		}
+		q.l.Lock()
+		if q.firstErr == nil {
+			q.firstErr = err
+		}
+		q.l.Unlock()
+	}
+	q.l.Lock()
+	q.pending[r.name] = r.encoded
+	q.l.Unlock()
+}
+
+func (q *storeQueue) storeWithRetries(r storeRequest) error {
+	backoff := q.options.Backoff
+	for attempt := 0; ; attempt++ {
+		if q.options.RateLimiter != nil {
+			err := q.options.RateLimiter.Wait(r.ctx)
+			if err != nil {
+				return fmt.Errorf("rate limiter: %w", err)
+			}
+		}
+		err := q.persist.Store(r.ctx, r.name, r.encoded)
+		if err == nil {
+			return nil
+		}
+		if attempt == q.options.Retries {
+			return fmt.Errorf("persist store: %w", err)
+		}
+		if backoff > 0 {
+			select {
+			case <-r.ctx.Done():
+				return r.ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// err returns the first error from a store so far.
+func (q *storeQueue) err() error {
+	q.l.Lock()
+	defer q.l.Unlock()
+	return q.firstErr
+}
+
+// wait stops accepting stores, and returns once those already sent have finished, with the
+// first error.
+func (q *storeQueue) wait() error {
+	close(q.ch)
+	q.wg.Wait()
+	return q.err()
+}
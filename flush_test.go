@@ -0,0 +1,120 @@
+package mast
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStore fails the first store of each node.
+type flakyStore struct {
+	Persist
+	l     sync.Mutex
+	calls int
+	tried map[string]bool
+}
+
+func (fs *flakyStore) Store(ctx context.Context, name string, b []byte) error {
+	fs.l.Lock()
+	fs.calls++
+	tried := fs.tried[name]
+	fs.tried[name] = true
+	fs.l.Unlock()
+	if !tried {
+		return errors.New("try again")
+	}
+	return fs.Persist.Store(ctx, name, b)
+}
+
+// concurrencyStore records the most stores it has had in flight at once.
+type concurrencyStore struct {
+	Persist
+	l                  sync.Mutex
+	inFlight, maxSoFar int
+}
+
+func (cs *concurrencyStore) Store(ctx context.Context, name string, b []byte) error {
+	cs.l.Lock()
+	cs.inFlight++
+	if cs.inFlight > cs.maxSoFar {
+		cs.maxSoFar = cs.inFlight
+	}
+	cs.l.Unlock()
+	time.Sleep(time.Millisecond)
+	cs.l.Lock()
+	cs.inFlight--
+	cs.l.Unlock()
+	return cs.Persist.Store(ctx, name, b)
+}
+
+type countingLimiter struct {
+	waits int64
+}
+
+func (cl *countingLimiter) Wait(context.Context) error {
+	atomic.AddInt64(&cl.waits, 1)
+	return nil
+}
+
+func newFlushTestTree(t *testing.T, store Persist, options *FlushOptions) (*Mast, *RemoteConfig) {
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store, FlushOptions: options}
+	m, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	return m, &config
+}
+
+func TestFlushRetries(t *testing.T) {
+	t.Parallel()
+	store := &flakyStore{Persist: NewInMemoryStore(), tried: map[string]bool{}}
+	m, config := newFlushTestTree(t, store, &FlushOptions{Retries: 1, Backoff: time.Microsecond})
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	report, err := Verify(ctx, root, config)
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Problems)
+	stats := m.FlushStats()
+	require.Equal(t, uint64(report.Nodes), stats.Nodes)
+	require.Equal(t, 2*int(stats.Nodes), store.calls)
+
+	m, _ = newFlushTestTree(t, &flakyStore{Persist: NewInMemoryStore(), tried: map[string]bool{}}, nil)
+	_, err = m.MakeRoot(ctx)
+	require.Error(t, err)
+}
+
+func TestFlushResumes(t *testing.T) {
+	t.Parallel()
+	store := &failingStore{Persist: NewInMemoryStore(), remaining: 20}
+	m, config := newFlushTestTree(t, store, &FlushOptions{Concurrency: 3})
+	_, err := m.MakeRoot(ctx)
+	require.Error(t, err)
+	require.Len(t, storedNames(t, store.Persist), 20)
+
+	store.l.Lock()
+	store.remaining = -1
+	store.l.Unlock()
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	report, err := Verify(ctx, root, config)
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Problems)
+	require.Equal(t, uint64(report.Nodes), m.FlushStats().Nodes)
+}
+
+func TestFlushConcurrencyAndRateLimit(t *testing.T) {
+	t.Parallel()
+	store := &concurrencyStore{Persist: NewInMemoryStore()}
+	limiter := &countingLimiter{}
+	m, _ := newFlushTestTree(t, store, nil)
+	_, err := m.MakeRootWithOptions(ctx, &FlushOptions{Concurrency: 2, RateLimiter: limiter})
+	require.NoError(t, err)
+	require.Equal(t, 2, store.maxSoFar)
+	require.Equal(t, int64(m.FlushStats().Nodes), atomic.LoadInt64(&limiter.waits))
+}
@@ -0,0 +1,140 @@
+package mast
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// nodeHashSize is the length of the blake2b-256 hashes that persisted nodes are named by.
+const nodeHashSize = 32
+
+// GCOptions controls CollectGarbage.
+type GCOptions struct {
+	// DryRun reports which nodes would be collected, without deleting them.
+	DryRun bool
+	// GracePeriod protects unreachable nodes stored more recently than this, so that nodes
+	// written by concurrent writers that haven't made their roots yet aren't collected.
+	// Storing a node that already exists must refresh its modification time, as the
+	// Persists in this module do. It is only safe when no concurrent writer skips storing
+	// nodes because a NodeCache that outlives the collection says they're already stored,
+	// since a new root could then reuse an old node that gets collected.
+	GracePeriod time.Duration
+	// Commits has the names of commits whose roots, and those of all their ancestors, are
+	// kept as well as the given roots. Commits themselves are never collected.
+	Commits []string
+}
+
+// GCResult summarizes a CollectGarbage run.
+type GCResult struct {
+	// Reachable is the number of nodes reachable from the given roots.
+	Reachable int
+	// Recent is the number of unreachable nodes kept because of the grace period.
+	Recent int
+	// Collected has the names of the nodes deleted, or that would be deleted in a dry run.
+	Collected []string
+}
+
+// CollectGarbage deletes the nodes in config.StoreImmutablePartsWith that are not
+// reachable from any of the given roots. The store must implement Lister, and Deleter
+// unless options.DryRun is set. Only names that look like node hashes are considered, so
+// other things kept in the same store are left alone.
+//
+// A NodeCache remembers which nodes have been stored, so trees sharing a NodeCache with
+// config would skip re-storing collected nodes; use a fresh NodeCache after collecting.
+func CollectGarbage(ctx context.Context, config *RemoteConfig, roots []*Root, options GCOptions) (*GCResult, error) {
+	persist := config.StoreImmutablePartsWith
+	lister, ok := persist.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("%T does not implement mast.Lister", persist)
+	}
+	deleter, ok := persist.(Deleter)
+	if !ok && !options.DryRun {
+		return nil, fmt.Errorf("%T does not implement mast.Deleter", persist)
+	}
+	cutoff := time.Now().Add(-options.GracePeriod)
+
+	roots = append([]*Root{}, roots...)
+	for _, name := range options.Commits {
+		err := Log(ctx, persist, name, func(_ string, c *Commit) error {
+			roots = append(roots, &c.Root)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("log %s: %w", name, err)
+		}
+	}
+
+	reachable := map[string]bool{}
+	for _, root := range roots {
+		m, err := root.LoadMast(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("load root: %w", err)
+		}
+		err = m.markReachable(ctx, m.root, reachable)
+		if err != nil {
+			return nil, fmt.Errorf("mark: %w", err)
+		}
+	}
+
+	result := GCResult{Reachable: len(reachable)}
+	err := lister.List(ctx, "", func(name string, modified time.Time) error {
+		if reachable[name] || !isNodeName(name) {
+			return nil
+		}
+		if modified.After(cutoff) {
+			result.Recent++
+			return nil
+		}
+		result.Collected = append(result.Collected, name)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list: %w", err)
+	}
+	if options.DryRun {
+		return &result, nil
+	}
+	for _, name := range result.Collected {
+		err = deleter.Delete(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("delete %s: %w", name, err)
+		}
+	}
+	return &result, nil
+}
+
+// markReachable adds the names of the persisted nodes under the given link to reachable.
+// Subtrees already marked are not revisited.
+func (m *Mast) markReachable(ctx context.Context, link interface{}, reachable map[string]bool) error {
+	if link == nil {
+		return nil
+	}
+	if name, ok := link.(string); ok {
+		if reachable[name] {
+			return nil
+		}
+		reachable[name] = true
+	}
+	node, err := m.load(ctx, link)
+	if err != nil {
+		return fmt.Errorf("load: %w", err)
+	}
+	for _, child := range node.Link {
+		err = m.markReachable(ctx, child, reachable)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isNodeName indicates the given name has the form of a persisted node's hash.
+func isNodeName(name string) bool {
+	if len(name) != base64.RawURLEncoding.EncodedLen(nodeHashSize) {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(name)
+	return err == nil
+}
@@ -0,0 +1,96 @@
+package mast
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func storedNames(t *testing.T, store Persist) map[string]bool {
+	names := map[string]bool{}
+	require.NoError(t, store.(Lister).List(ctx, "", func(name string, _ time.Time) error {
+		names[name] = true
+		return nil
+	}))
+	return names
+}
+
+func TestCollectGarbage(t *testing.T) {
+	t.Parallel()
+	store := NewInMemoryStore()
+	config := RemoteConfig{
+		KeysLike:                1,
+		ValuesLike:              "",
+		StoreImmutablePartsWith: store,
+	}
+	m, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, "old"))
+	}
+	oldRoot, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i += 10 {
+		require.NoError(t, m.Insert(ctx, i, "new"))
+	}
+	newRoot, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	require.NoError(t, store.Store(ctx, "not-a-node", []byte("keep me")))
+	before := storedNames(t, store)
+
+	result, err := CollectGarbage(ctx, &config, []*Root{oldRoot, newRoot}, GCOptions{})
+	require.NoError(t, err)
+	require.Empty(t, result.Collected)
+	require.Equal(t, len(before)-1, result.Reachable)
+
+	result, err = CollectGarbage(ctx, &config, []*Root{newRoot}, GCOptions{GracePeriod: time.Hour})
+	require.NoError(t, err)
+	require.Empty(t, result.Collected)
+	require.NotZero(t, result.Recent)
+
+	result, err = CollectGarbage(ctx, &config, []*Root{newRoot}, GCOptions{DryRun: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, result.Collected)
+	require.Equal(t, before, storedNames(t, store))
+
+	result, err = CollectGarbage(ctx, &config, []*Root{newRoot}, GCOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, result.Collected)
+	after := storedNames(t, store)
+	require.Len(t, after, len(before)-len(result.Collected))
+	require.True(t, after["not-a-node"])
+
+	// the live root is intact; the old one is not
+	m, err = newRoot.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	require.NoError(t, m.Iter(ctx, func(k, v interface{}) error {
+		if k.(int)%10 == 0 {
+			require.Equal(t, "new", v)
+		} else {
+			require.Equal(t, "old", v)
+		}
+		return nil
+	}))
+	m, err = oldRoot.LoadMast(ctx, &config)
+	if err == nil {
+		err = m.Iter(ctx, func(_, _ interface{}) error { return nil })
+	}
+	require.Error(t, err)
+}
+
+type unlistableStore struct {
+	Persist
+}
+
+func TestCollectGarbageRequiresLister(t *testing.T) {
+	t.Parallel()
+	config := RemoteConfig{
+		KeysLike:                1,
+		ValuesLike:              "",
+		StoreImmutablePartsWith: unlistableStore{NewInMemoryStore()},
+	}
+	_, err := CollectGarbage(context.Background(), &config, nil, GCOptions{DryRun: true})
+	require.Error(t, err)
+}
@@ -3,25 +3,38 @@ package mast
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 type inMemoryStore struct {
-	entries map[string][]byte
-	l       sync.Mutex
+	entries  map[string][]byte
+	modified map[string]time.Time
+	l        sync.Mutex
 }
 
 // NewInMemoryStore provides a Persist that stores serialized nodes in a map, usually for testing.
+// It also implements Lister, Deleter and Exister.
 func NewInMemoryStore() Persist {
 	return &inMemoryStore{}
 }
 
+var (
+	_ Lister  = &inMemoryStore{}
+	_ Deleter = &inMemoryStore{}
+	_ Exister = &inMemoryStore{}
+)
+
 func (ims *inMemoryStore) Store(ctx context.Context, key string, value []byte) error {
 	ims.l.Lock()
 	if ims.entries == nil {
 		ims.entries = map[string][]byte{key: value}
+		ims.modified = map[string]time.Time{key: time.Now()}
 	} else {
 		ims.entries[key] = value
+		ims.modified[key] = time.Now()
 	}
 	ims.l.Unlock()
 	return nil
@@ -32,7 +45,7 @@ func (ims *inMemoryStore) Load(ctx context.Context, key string) ([]byte, error)
 	value, ok := ims.entries[key]
 	ims.l.Unlock()
 	if !ok {
-		return nil, fmt.Errorf("inMemoryStore entry not found for %s", key)
+		return nil, fmt.Errorf("inMemoryStore entry for %s: %w", key, ErrNotFound)
 	}
 	return value, nil
 }
@@ -40,3 +53,40 @@ func (ims *inMemoryStore) Load(ctx context.Context, key string) ([]byte, error)
 func (ims *inMemoryStore) NodeURLPrefix() string {
 	return fmt.Sprintf("%p", ims)
 }
+
+// List invokes the callback for each stored entry with the given prefix, in name order.
+func (ims *inMemoryStore) List(ctx context.Context, prefix string, fn func(string, time.Time) error) error {
+	ims.l.Lock()
+	names := make([]string, 0, len(ims.entries))
+	modified := make(map[string]time.Time, len(ims.entries))
+	for name := range ims.entries {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+			modified[name] = ims.modified[name]
+		}
+	}
+	ims.l.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		err := fn(name, modified[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ims *inMemoryStore) Delete(ctx context.Context, key string) error {
+	ims.l.Lock()
+	delete(ims.entries, key)
+	delete(ims.modified, key)
+	ims.l.Unlock()
+	return nil
+}
+
+func (ims *inMemoryStore) Exists(ctx context.Context, key string) (bool, error) {
+	ims.l.Lock()
+	_, ok := ims.entries[key]
+	ims.l.Unlock()
+	return ok, nil
+}
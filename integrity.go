@@ -0,0 +1,57 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ErrCorruptNode is returned when the bytes loaded for a node don't hash to its name.
+type ErrCorruptNode struct {
+	// Name is the name the node was loaded by.
+	Name string
+	// Got is the name the loaded bytes hash to.
+	Got string
+}
+
+func (e ErrCorruptNode) Error() string {
+	return fmt.Sprintf("corrupt node %s: content hashes to %s", e.Name, e.Got)
+}
+
+// checkNodeHash returns ErrCorruptNode if the given bytes don't hash to the given name.
+// Commits are checked too, since they are named the same way.
+func checkNodeHash(name string, b []byte) error {
+	hash := hashNode(b)
+	if strings.HasPrefix(name, commitNamePrefix) {
+		hash = commitNamePrefix + hash
+	}
+	if hash != name {
+		return ErrCorruptNode{Name: name, Got: hash}
+	}
+	return nil
+}
+
+// verifyingPersist checks that what it loads hashes to the name it was loaded by.
+type verifyingPersist struct {
+	WrappedPersist
+}
+
+// NewVerifyingPersist returns a Persist that checks that whatever is loaded from the given
+// one hashes to the name it was loaded by, returning ErrCorruptNode if not. It is for
+// Persists holding only nodes and commits, which are named by their hash. List, Delete and
+// Exists are forwarded to the given Persist, as WrappedPersist describes.
+func NewVerifyingPersist(p Persist) Persist {
+	return verifyingPersist{WrappedPersist{p}}
+}
+
+func (p verifyingPersist) Load(ctx context.Context, name string) ([]byte, error) {
+	b, err := p.Persist.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	err = checkNodeHash(name, b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
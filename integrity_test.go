@@ -0,0 +1,90 @@
+package mast
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyNodes(t *testing.T) {
+	t.Parallel()
+	store := NewInMemoryStore()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store}
+	m, err := NewRoot(&CreateRemoteOptions{BranchFactor: 4}).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+
+	// replace a leaf with another, well-formed one
+	var leaves []string
+	for name := range storedNames(t, store) {
+		b, err := store.Load(ctx, name)
+		require.NoError(t, err)
+		node, err := m.decodeNode(b, name)
+		require.NoError(t, err)
+		leaf := len(node.Key) > 0
+		for _, link := range node.Link {
+			leaf = leaf && link == nil
+		}
+		if leaf {
+			leaves = append(leaves, name)
+		}
+	}
+	require.Greater(t, len(leaves), 1)
+	sort.Strings(leaves)
+	otherBytes, err := store.Load(ctx, leaves[1])
+	require.NoError(t, err)
+	require.NoError(t, store.Store(ctx, leaves[0], otherBytes))
+
+	keys := func(m *Mast) ([]int, error) {
+		var keys []int
+		err := m.Iter(ctx, func(k, _ interface{}) error {
+			keys = append(keys, k.(int))
+			return nil
+		})
+		return keys, err
+	}
+	m, err = root.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	wrong, err := keys(m)
+	require.NoError(t, err)
+	require.False(t, sort.IntsAreSorted(wrong))
+
+	config.VerifyNodes = true
+	m, err = root.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	_, err = keys(m)
+	var corrupt ErrCorruptNode
+	require.True(t, errors.As(err, &corrupt), "%v", err)
+	require.Equal(t, ErrCorruptNode{Name: leaves[0], Got: leaves[1]}, corrupt)
+}
+
+func TestVerifyingPersist(t *testing.T) {
+	t.Parallel()
+	store := NewInMemoryStore()
+	p := NewVerifyingPersist(store)
+	name, err := StoreCommit(ctx, p, &Commit{Time: time.Unix(0, 0).UTC()})
+	require.NoError(t, err)
+	c, err := LoadCommit(ctx, p, name)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(0, 0).UTC(), c.Time)
+
+	good := hashNode([]byte("hello"))
+	require.NoError(t, p.Store(ctx, good, []byte("hello")))
+	b, err := p.Load(ctx, good)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), b)
+
+	require.NoError(t, store.Store(ctx, good, []byte("goodbye")))
+	_, err = p.Load(ctx, good)
+	require.Equal(t, ErrCorruptNode{Name: good, Got: hashNode([]byte("goodbye"))}, err)
+	require.NoError(t, store.Store(ctx, name, []byte("{}")))
+	_, err = LoadCommit(ctx, p, name)
+	require.ErrorAs(t, err, &ErrCorruptNode{})
+}
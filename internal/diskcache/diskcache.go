@@ -0,0 +1,195 @@
+// Package diskcache is a size-capped cache of byte strings in a local directory. Entries
+// are written atomically, so the directory can be shared by any number of processes.
+package diskcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tempPrefix starts the names of entries still being written.
+const tempPrefix = ".tmp-"
+
+// Cache keeps entries as files named by the hash of their key. When the files add up to
+// more than the cap, the least-recently used are removed until they're back under
+// three-quarters of it.
+type Cache struct {
+	dir      string
+	maxBytes int64
+	l        sync.Mutex
+	// size is what this process believes the directory holds; it is corrected whenever
+	// entries are evicted, to account for other processes' entries.
+	size int64
+}
+
+// New returns a cache of at most maxBytes in the given directory, creating it if needed.
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("maxBytes must be positive")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cache{dir: dir, maxBytes: maxBytes}
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		c.size += f.size
+	}
+	return c, nil
+}
+
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// Get returns the bytes cached for the given key, if any.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	path := c.path(key)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return b, true
+}
+
+// Remove removes the bytes cached for the given key, if any.
+func (c *Cache) Remove(key string) error {
+	path := c.path(key)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.l.Lock()
+	c.size -= info.Size()
+	c.l.Unlock()
+	return nil
+}
+
+// Put caches the given bytes for the given key, evicting older entries if the cache
+// becomes too big.
+func (c *Cache) Put(key string, b []byte) error {
+	path := c.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), tempPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.size += int64(len(b))
+	if c.size <= c.maxBytes {
+		return nil
+	}
+	return c.evict()
+}
+
+type file struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files lists the cache's entries, including those still being written.
+func (c *Cache) files() ([]file, error) {
+	var files []file
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files = append(files, file{path, info.Size(), info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", c.dir, err)
+	}
+	return files, nil
+}
+
+// evict removes the least-recently used entries until the cache is under three-quarters
+// of its cap.
+func (c *Cache) evict() error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	c.size = 0
+	for _, f := range files {
+		c.size += f.size
+	}
+	recent := time.Now().Add(-time.Minute)
+	for _, f := range files {
+		if c.size <= c.maxBytes*3/4 {
+			break
+		}
+		if strings.HasPrefix(filepath.Base(f.path), tempPrefix) && f.modTime.After(recent) {
+			// probably still being written
+			continue
+		}
+		err = os.Remove(f.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.size -= f.size
+	}
+	return nil
+}
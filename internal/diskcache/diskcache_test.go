@@ -0,0 +1,58 @@
+package diskcache
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, 1000)
+	require.NoError(t, err)
+	_, ok := c.Get("a")
+	require.False(t, ok)
+	require.NoError(t, c.Put("a", []byte("apple")))
+	require.NoError(t, c.Put("a", []byte("apple")))
+	b, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, []byte("apple"), b)
+	require.NoError(t, c.Remove("a"))
+	require.NoError(t, c.Remove("a"))
+	_, ok = c.Get("a")
+	require.False(t, ok)
+	require.Zero(t, c.size)
+	require.NoError(t, c.Put("a", []byte("apple")))
+
+	other, err := New(dir, 1000)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), other.size)
+	b, ok = other.Get("a")
+	require.True(t, ok)
+	require.Equal(t, []byte("apple"), b)
+}
+
+func TestEviction(t *testing.T) {
+	c, err := New(t.TempDir(), 100)
+	require.NoError(t, err)
+	value := bytes.Repeat([]byte{'x'}, 20)
+	hourAgo := time.Now().Add(-time.Hour)
+	for i := 0; i < 4; i++ {
+		key := fmt.Sprintf("k%d", i)
+		require.NoError(t, c.Put(key, value))
+		require.NoError(t, os.Chtimes(c.path(key), hourAgo, hourAgo.Add(time.Duration(i)*time.Second)))
+	}
+	_, ok := c.Get("k0")
+	require.True(t, ok)
+	require.NoError(t, c.Put("k4", value))
+	require.NoError(t, c.Put("k5", value))
+	for i, expected := range []bool{true, false, false, false, true, true} {
+		_, err := os.Stat(c.path(fmt.Sprintf("k%d", i)))
+		require.Equal(t, expected, err == nil, "k%d", i)
+	}
+	require.Equal(t, int64(60), c.size)
+}
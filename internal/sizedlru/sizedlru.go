@@ -0,0 +1,110 @@
+// Package sizedlru is a least-recently-used cache that is bounded by the total size of its
+// entries, rather than by their number.
+package sizedlru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is safe for concurrent use.
+type Cache struct {
+	l        sync.Mutex
+	maxBytes int64
+	bytes    int64
+	ll       *list.List
+	items    map[interface{}]*list.Element
+}
+
+type entry struct {
+	key, value interface{}
+	size       int64
+}
+
+// New returns a cache whose entries' sizes add up to at most maxBytes. A negative maxBytes
+// is taken as 0, so nothing is kept.
+func New(maxBytes int64) *Cache {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	return &Cache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    map[interface{}]*list.Element{},
+	}
+}
+
+// Add adds or replaces the entry for the given key, evicting the least-recently used entries
+// as needed to keep within the cache's size. An entry bigger than the whole cache is evicted
+// immediately. Returns the number of entries evicted.
+func (c *Cache) Add(key, value interface{}, size int64) int {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		ent := e.Value.(*entry)
+		c.bytes += size - ent.size
+		ent.value, ent.size = value, size
+	} else {
+		c.items[key] = c.ll.PushFront(&entry{key, value, size})
+		c.bytes += size
+	}
+	evicted := 0
+	for c.bytes > c.maxBytes && c.ll.Len() > 0 {
+		c.removeElement(c.ll.Back())
+		evicted++
+	}
+	return evicted
+}
+
+// Get returns the value for the given key, if cached, and marks it as recently used.
+func (c *Cache) Get(key interface{}) (interface{}, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*entry).value, true
+}
+
+// Contains indicates whether the given key is cached, without marking it as recently used.
+func (c *Cache) Contains(key interface{}) bool {
+	c.l.Lock()
+	defer c.l.Unlock()
+	_, ok := c.items[key]
+	return ok
+}
+
+// Remove removes the entry for the given key, returning whether there was one.
+func (c *Cache) Remove(key interface{}) bool {
+	c.l.Lock()
+	defer c.l.Unlock()
+	e, ok := c.items[key]
+	if ok {
+		c.removeElement(e)
+	}
+	return ok
+}
+
+func (c *Cache) removeElement(e *list.Element) {
+	ent := e.Value.(*entry)
+	c.ll.Remove(e)
+	delete(c.items, ent.key)
+	c.bytes -= ent.size
+}
+
+// Len returns the number of entries cached.
+func (c *Cache) Len() int {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.ll.Len()
+}
+
+// Bytes returns the total size of the entries cached.
+func (c *Cache) Bytes() int64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.bytes
+}
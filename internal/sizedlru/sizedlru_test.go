@@ -0,0 +1,44 @@
+package sizedlru
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	c := New(100)
+	require.Zero(t, c.Add("a", 1, 40))
+	require.Zero(t, c.Add("b", 2, 40))
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	require.Equal(t, 1, c.Add("c", 3, 40))
+	require.False(t, c.Contains("b"))
+	require.True(t, c.Contains("a"))
+	require.Equal(t, 2, c.Len())
+	require.Equal(t, int64(80), c.Bytes())
+
+	require.Zero(t, c.Add("a", 4, 10))
+	v, ok = c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 4, v)
+	require.Equal(t, int64(50), c.Bytes())
+
+	require.True(t, c.Remove("a"))
+	require.False(t, c.Remove("a"))
+	_, ok = c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, int64(40), c.Bytes())
+
+	require.Equal(t, 2, c.Add("huge", 5, 101))
+	require.Zero(t, c.Len())
+	require.Zero(t, c.Bytes())
+}
+
+func TestNegativeMaxBytes(t *testing.T) {
+	c := New(-1)
+	require.Equal(t, 1, c.Add("a", 1, 1))
+	require.Equal(t, 0, c.Len())
+	require.Zero(t, c.Bytes())
+}
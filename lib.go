@@ -29,6 +29,15 @@ type Mast struct {
 	debug                          bool
 	nodeCache                      NodeCache
 	nodeFormat                     nodeFormat
+	dirtyNodeBudget                uint64
+	// dirtyEstimate is an upper bound on the number of dirty nodes, when there's a budget.
+	dirtyEstimate uint64
+	flushStats    FlushStats
+	flushOptions  *FlushOptions
+	// pendingStores has serialized nodes that a failed flush didn't store.
+	pendingStores map[string][]byte
+	prefetcher    *prefetcher
+	verifyNodes   bool
 }
 
 type mastNode struct {
@@ -37,6 +46,13 @@ type mastNode struct {
 	shared   bool
 	expected *mastNode
 	source   *string
+	// linkCount has the number of entries under each link, for node formats that persist
+	// them. Only valid while the node is not dirty.
+	linkCount []uint64
+	// counted is the stored node this one was copied from, whose linkCount has the number
+	// of entries under the links they still share, so that they needn't be loaded to be
+	// counted again.
+	counted *mastNode
 }
 
 type Node struct {
@@ -101,7 +117,7 @@ func split(ctx context.Context, node *mastNode, key interface{}, mast *Mast) (le
 			make([]interface{}, 0, cap(node.Value)),
 			make([]interface{}, 0, cap(node.Link)),
 		},
-		true, false, nil, nil,
+		true, false, nil, nil, nil, node.countSource(),
 	}
 	left.Key = append(left.Key, node.Key[:splitIndex]...)
 	left.Value = append(left.Value, node.Value[:splitIndex]...)
@@ -139,7 +155,7 @@ func split(ctx context.Context, node *mastNode, key interface{}, mast *Mast) (le
 			make([]interface{}, 0, cap(node.Value)),
 			make([]interface{}, 0, cap(node.Link)),
 		},
-		true, false, nil, nil,
+		true, false, nil, nil, nil, node.countSource(),
 	}
 	right.Key = append(right.Key, node.Key[splitIndex:]...)
 	right.Value = append(right.Value, node.Value[splitIndex:]...)
@@ -510,6 +526,7 @@ func (node *mastNode) iter(ctx context.Context, f func(interface{}, interface{})
 	if mast.debug {
 		fmt.Printf("starting iter at node with keys: %v\n", node.Key)
 	}
+	mast.prefetch(ctx, node.Link)
 	for i, link := range node.Link {
 		if link != nil {
 			child, err := mast.load(ctx, link)
@@ -540,6 +557,7 @@ func (node *mastNode) seekIter(ctx context.Context, idx int, f func(interface{},
 	if err != nil {
 		return err
 	}
+	m.prefetch(ctx, node.Link[idx+1:])
 	for i := idx + 1; i < len(node.Link); i++ {
 		link := node.Link[i]
 		if link != nil {
@@ -649,7 +667,7 @@ func (node *mastNode) xcopy() *mastNode {
 			make([]interface{}, 0, cap(node.Value)),
 			make([]interface{}, 0, cap(node.Link)),
 		},
-		node.dirty, node.shared, nil, nil,
+		node.dirty, node.shared, nil, nil, nil, node.countSource(),
 	}
 	newNode.Key = append(newNode.Key, node.Key...)
 	newNode.Value = append(newNode.Value, node.Value...)
@@ -657,6 +675,29 @@ func (node *mastNode) xcopy() *mastNode {
 	return &newNode
 }
 
+// countSource returns the stored node with the counts of this node's links that are
+// unchanged since it was stored, or nil.
+func (node *mastNode) countSource() *mastNode {
+	if !node.dirty && node.linkCount != nil {
+		return node
+	}
+	return node.counted
+}
+
+// storedCount returns the number of entries under the given link, if it was counted by the
+// stored node this one was copied from.
+func (node *mastNode) storedCount(link string) (uint64, bool) {
+	if node.counted == nil {
+		return 0, false
+	}
+	for i, l := range node.counted.Link {
+		if l == link && i < len(node.counted.linkCount) {
+			return node.counted.linkCount[i], true
+		}
+	}
+	return 0, false
+}
+
 func (m *Mast) checkRoot(ctx context.Context) error {
 	node, err := m.load(ctx, m.root)
 	if err != nil {
@@ -726,6 +767,7 @@ func (node *mastNode) ToShared() (*mastNode, error) {
 }
 
 func (node *mastNode) Dirty() {
+	node.dirty = true
 	node.expected = nil
 	node.source = nil
 }
@@ -1226,3 +1226,34 @@ func TestCloneEmpty(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, uint64(0), m2.Size())
 }
+
+func TestDirtyMarksNode(t *testing.T) {
+	t.Parallel()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: NewInMemoryStore()}
+	m, err := NewRoot(&CreateRemoteOptions{NodeFormat: V115BinaryCounted, BranchFactor: 4}).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	m, err = root.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	stored, err := m.load(ctx, m.root)
+	require.NoError(t, err)
+	require.False(t, stored.dirty)
+	require.NotNil(t, stored.linkCount)
+
+	// a changed node's persisted counts and name no longer apply to it
+	node := stored.ToMut(ctx, m)
+	node.Dirty()
+	require.True(t, node.dirty)
+	require.Nil(t, node.source)
+	require.False(t, stored.dirty)
+	node.Link[0] = nil
+	m.root = node
+	require.Equal(t, uint64(1), countDirty(m.root))
+	n, err := node.childSize(ctx, m, 0)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
@@ -0,0 +1,139 @@
+package mast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrMergeConflict is returned by Merge when both sides changed the same key
+// differently and no resolver was given.
+var ErrMergeConflict = errors.New("conflicting changes")
+
+// Merge does a three-way merge of this tree and theirs, which were both derived from base,
+// returning a new tree with the changes from both sides. Only the differences from base
+// are visited, so subtrees that are unchanged on either side (having equal node hashes)
+// are skipped.
+//
+// When both sides have changed the same key differently, resolve is called with the
+// key and the base, our, and their values, any of which are nil if the entry was absent.
+// It returns the value to keep, or keep==false to leave the key out of the merged tree.
+// If resolve is nil, ErrMergeConflict is returned for such keys.
+//
+// The result is dirty, and can be persisted with MakeRoot.
+func (m *Mast) Merge(
+	ctx context.Context,
+	base, theirs *Mast,
+	resolve func(key, base, ours, theirs interface{}) (interface{}, bool, error),
+) (*Mast, error) {
+	merged, err := m.Clone(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("clone: %w", err)
+	}
+	ourCursor, err := m.StartDiff(ctx, base)
+	if err != nil {
+		return nil, fmt.Errorf("start our diff: %w", err)
+	}
+	theirCursor, err := theirs.StartDiff(ctx, base)
+	if err != nil {
+		return nil, fmt.Errorf("start their diff: %w", err)
+	}
+	ourDiff, ourOk, err := nextDiff(ctx, ourCursor)
+	if err != nil {
+		return nil, fmt.Errorf("our diff: %w", err)
+	}
+	theirDiff, theirOk, err := nextDiff(ctx, theirCursor)
+	if err != nil {
+		return nil, fmt.Errorf("their diff: %w", err)
+	}
+	for theirOk {
+		cmp := 1
+		if ourOk {
+			cmp, err = m.keyOrder(ourDiff.Key, theirDiff.Key)
+			if err != nil {
+				return nil, fmt.Errorf("keyCompare: %w", err)
+			}
+		}
+		if cmp < 0 {
+			// only we changed it, and merged already has our change
+			ourDiff, ourOk, err = nextDiff(ctx, ourCursor)
+			if err != nil {
+				return nil, fmt.Errorf("our diff: %w", err)
+			}
+			continue
+		}
+		if cmp > 0 {
+			err = merged.applyDiff(ctx, theirDiff)
+			if err != nil {
+				return nil, fmt.Errorf("apply %v: %w", theirDiff.Key, err)
+			}
+		} else if !sameOutcome(ourDiff, theirDiff) {
+			err = merged.resolveConflict(ctx, ourDiff, theirDiff, resolve)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if cmp == 0 {
+			ourDiff, ourOk, err = nextDiff(ctx, ourCursor)
+			if err != nil {
+				return nil, fmt.Errorf("our diff: %w", err)
+			}
+		}
+		theirDiff, theirOk, err = nextDiff(ctx, theirCursor)
+		if err != nil {
+			return nil, fmt.Errorf("their diff: %w", err)
+		}
+	}
+	return &merged, nil
+}
+
+func nextDiff(ctx context.Context, dc *DiffCursor) (Diff, bool, error) {
+	d, err := dc.NextEntry(ctx)
+	if err == ErrNoMoreDiffs {
+		return Diff{}, false, nil
+	}
+	if err != nil {
+		return Diff{}, false, err
+	}
+	return d, true, nil
+}
+
+// sameOutcome indicates both diffs left the key with the same value, or both removed it.
+func sameOutcome(ours, theirs Diff) bool {
+	if ours.Type == DiffType_Remove || theirs.Type == DiffType_Remove {
+		return ours.Type == theirs.Type
+	}
+	return reflect.DeepEqual(ours.NewValue, theirs.NewValue)
+}
+
+// applyDiff applies a change made relative to the base, to a tree that still has the base's entry.
+func (m *Mast) applyDiff(ctx context.Context, d Diff) error {
+	if d.Type == DiffType_Remove {
+		_, _, err := m.DeleteKey(ctx, d.Key)
+		return err
+	}
+	return m.Insert(ctx, d.Key, d.NewValue)
+}
+
+func (m *Mast) resolveConflict(
+	ctx context.Context,
+	ours, theirs Diff,
+	resolve func(key, base, ours, theirs interface{}) (interface{}, bool, error),
+) error {
+	if resolve == nil {
+		return fmt.Errorf("key %v: %w", ours.Key, ErrMergeConflict)
+	}
+	value, keep, err := resolve(ours.Key, ours.OldValue, ours.NewValue, theirs.NewValue)
+	if err != nil {
+		return fmt.Errorf("resolve %v: %w", ours.Key, err)
+	}
+	if keep {
+		return m.Insert(ctx, ours.Key, value)
+	}
+	if ours.Type == DiffType_Remove {
+		return nil
+	}
+	_, _, err = m.DeleteKey(ctx, ours.Key)
+	return err
+}
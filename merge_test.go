@@ -0,0 +1,148 @@
+package mast
+
+import (
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/arbitrary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeDisjointChanges(t *testing.T) {
+	t.Parallel()
+	base := newTestTree(0, 0)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, base.Insert(ctx, i, i))
+	}
+	_, err := base.MakeRoot(ctx)
+	require.NoError(t, err)
+	ours, err := base.Clone(ctx)
+	require.NoError(t, err)
+	theirs, err := base.Clone(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, ours.Insert(ctx, 5, 500))
+	require.NoError(t, ours.Delete(ctx, 6, 6))
+	require.NoError(t, ours.Insert(ctx, 1000, 1000))
+	require.NoError(t, theirs.Insert(ctx, 50, 5000))
+	require.NoError(t, theirs.Delete(ctx, 60, 60))
+	require.NoError(t, theirs.Insert(ctx, 2000, 2000))
+
+	merged, err := ours.Merge(ctx, &base, &theirs, nil)
+	require.NoError(t, err)
+	require.True(t, merged.IsDirty())
+	require.Equal(t, uint64(100), merged.Size())
+	expected := map[int]int{}
+	for i := 0; i < 100; i++ {
+		expected[i] = i
+	}
+	expected[5] = 500
+	delete(expected, 6)
+	expected[1000] = 1000
+	expected[50] = 5000
+	delete(expected, 60)
+	expected[2000] = 2000
+	actual := map[int]int{}
+	require.NoError(t, merged.Iter(ctx, func(k, v interface{}) error {
+		actual[k.(int)] = v.(int)
+		return nil
+	}))
+	require.Equal(t, expected, actual)
+	_, err = merged.MakeRoot(ctx)
+	require.NoError(t, err)
+}
+
+func TestMergeConflicts(t *testing.T) {
+	t.Parallel()
+	base := newTestTree(0, 0)
+	require.NoError(t, base.Insert(ctx, 1, 1))
+	require.NoError(t, base.Insert(ctx, 2, 2))
+	require.NoError(t, base.Insert(ctx, 3, 3))
+	ours, err := base.Clone(ctx)
+	require.NoError(t, err)
+	theirs, err := base.Clone(ctx)
+	require.NoError(t, err)
+
+	// same change on both sides isn't a conflict
+	require.NoError(t, ours.Insert(ctx, 1, 10))
+	require.NoError(t, theirs.Insert(ctx, 1, 10))
+	// different changes are
+	require.NoError(t, ours.Insert(ctx, 2, 20))
+	require.NoError(t, theirs.Insert(ctx, 2, 200))
+	require.NoError(t, ours.Delete(ctx, 3, 3))
+	require.NoError(t, theirs.Insert(ctx, 3, 300))
+	require.NoError(t, ours.Insert(ctx, 4, 40))
+	require.NoError(t, theirs.Insert(ctx, 4, 400))
+
+	_, err = ours.Merge(ctx, &base, &theirs, nil)
+	require.ErrorIs(t, err, ErrMergeConflict)
+
+	type call struct {
+		key, base, ours, theirs interface{}
+	}
+	var calls []call
+	merged, err := ours.Merge(ctx, &base, &theirs,
+		func(key, base, ours, theirs interface{}) (interface{}, bool, error) {
+			calls = append(calls, call{key, base, ours, theirs})
+			if key == 4 {
+				return nil, false, nil
+			}
+			if ours == nil {
+				return theirs, true, nil
+			}
+			return ours.(int) + theirs.(int), true, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []call{
+		{2, 2, 20, 200},
+		{3, 3, nil, 300},
+		{4, nil, 40, 400},
+	}, calls)
+	actual := map[int]int{}
+	require.NoError(t, merged.Iter(ctx, func(k, v interface{}) error {
+		actual[k.(int)] = v.(int)
+		return nil
+	}))
+	require.Equal(t, map[int]int{1: 10, 2: 220, 3: 300}, actual)
+}
+
+func TestMergeProperty(t *testing.T) {
+	t.Parallel()
+	properties := gopter.NewProperties(defaultGopterParameters)
+	arbitraries := arbitrary.DefaultArbitraries()
+	properties.Property("merging disjoint changes applies both",
+		arbitraries.ForAll(
+			func(baseOps, ourOps, theirOps []TestOperation) bool {
+				base := newTestTree(uint(0), uint(0))
+				require.NoError(t, base.apply(baseOps))
+				ours, err := base.Clone(ctx)
+				require.NoError(t, err)
+				theirs, err := base.Clone(ctx)
+				require.NoError(t, err)
+				expected := map[uint]uint{}
+				for _, op := range baseOps {
+					expected[op.Key] = op.Value
+				}
+				for _, op := range ourOps {
+					op.Key = op.Key*2 + 1
+					require.NoError(t, ours.Insert(ctx, op.Key, op.Value))
+					expected[op.Key] = op.Value
+				}
+				for _, op := range theirOps {
+					op.Key *= 2
+					require.NoError(t, theirs.Insert(ctx, op.Key, op.Value))
+					expected[op.Key] = op.Value
+				}
+				merged, err := ours.Merge(ctx, &base, &theirs, nil)
+				require.NoError(t, err)
+				actual := map[uint]uint{}
+				require.NoError(t, merged.Iter(ctx, func(k, v interface{}) error {
+					actual[k.(uint)] = v.(uint)
+					return nil
+				}))
+				return assert.Equal(t, expected, actual) &&
+					assert.Equal(t, uint64(len(expected)), merged.Size())
+			}))
+	properties.TestingRun(t)
+}
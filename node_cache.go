@@ -1,6 +1,14 @@
 package mast
 
-import lru "github.com/hashicorp/golang-lru"
+import (
+	"fmt"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/jrhy/mast/internal/diskcache"
+	"github.com/jrhy/mast/internal/sizedlru"
+)
 
 // NodeCache caches the immutable nodes from a remote storage source.
 // It is also used to avoid re-storing nodes, so care should be taken
@@ -24,3 +32,192 @@ func NewNodeCache(size int) NodeCache {
 	}
 	return cache
 }
+
+// bytesCache is implemented by NodeCaches that also keep nodes' serialized bytes, which
+// outlive the process.
+type bytesCache interface {
+	getBytes(key string) ([]byte, bool)
+	addBytes(key string, b []byte)
+	removeBytes(key string)
+}
+
+// tieredNodeCache is an in-memory cache of deserialized nodes in front of an on-disk cache
+// of their serialized bytes.
+type tieredNodeCache struct {
+	mem  NodeCache
+	disk *diskcache.Cache
+}
+
+var _ bytesCache = (*tieredNodeCache)(nil)
+
+// NewTieredNodeCache creates a node cache that keeps the given number of nodes in memory,
+// like NewNodeCache, and up to maxBytes of serialized nodes in the given directory, so that
+// they can be loaded without going to the Persist after the process restarts. Any number
+// of processes can share the directory.
+func NewTieredNodeCache(size int, dir string, maxBytes int64) (NodeCache, error) {
+	disk, err := diskcache.New(dir, maxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("disk cache: %w", err)
+	}
+	return &tieredNodeCache{NewNodeCache(size), disk}, nil
+}
+
+func (c *tieredNodeCache) Add(key, value interface{}) {
+	c.mem.Add(key, value)
+}
+
+// Contains only consults the in-memory tier, since the directory may outlive what was
+// stored: after a restart, after CollectGarbage, or when it is shared by another Persist.
+func (c *tieredNodeCache) Contains(key interface{}) bool {
+	return c.mem.Contains(key)
+}
+
+func (c *tieredNodeCache) containsNode(key interface{}) bool {
+	return hasNode(c.mem, key)
+}
+
+func (c *tieredNodeCache) Get(key interface{}) (interface{}, bool) {
+	return c.mem.Get(key)
+}
+
+func (c *tieredNodeCache) getBytes(key string) ([]byte, bool) {
+	return c.disk.Get(key)
+}
+
+func (c *tieredNodeCache) addBytes(key string, b []byte) {
+	// The disk is only a cache; failing to write to it costs a load later.
+	_ = c.disk.Put(key, b)
+}
+
+func (c *tieredNodeCache) removeBytes(key string) {
+	_ = c.disk.Remove(key)
+}
+
+// sizedCache is implemented by NodeCaches that weigh nodes by their serialized size.
+type sizedCache interface {
+	addSized(key, value interface{}, size int)
+}
+
+// addToCache adds the given node to the given cache, with its serialized size if the cache
+// weighs nodes by it.
+func addToCache(cache NodeCache, key string, node *mastNode, size int) {
+	if sc, ok := cache.(sizedCache); ok {
+		sc.addSized(key, node, size)
+		return
+	}
+	cache.Add(key, node)
+}
+
+// nodeContainer is implemented by NodeCaches whose Contains can be true for nodes that
+// they don't hold.
+type nodeContainer interface {
+	containsNode(key interface{}) bool
+}
+
+// hasNode indicates whether the given cache holds the deserialized node with the given key.
+func hasNode(cache NodeCache, key interface{}) bool {
+	if nc, ok := cache.(nodeContainer); ok {
+		return nc.containsNode(key)
+	}
+	return cache.Contains(key)
+}
+
+// DefaultPersistedKeys is how many persisted nodes a SizedNodeCache remembers, unless told
+// otherwise.
+const DefaultPersistedKeys = 1 << 20
+
+// estimatedNodeSize is the weight of nodes added to a SizedNodeCache without their size.
+const estimatedNodeSize = 1024
+
+// SizedNodeCache is a NodeCache bounded by the total serialized size of the nodes it keeps,
+// which, unlike their number, is proportional to the memory they use. It separately
+// remembers which nodes have been persisted, so evicting a node doesn't cause it to be
+// stored again.
+type SizedNodeCache struct {
+	nodes     *sizedlru.Cache
+	persisted *lru.Cache
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+var (
+	_ sizedCache    = (*SizedNodeCache)(nil)
+	_ nodeContainer = (*SizedNodeCache)(nil)
+	_ nodeContainer = (*tieredNodeCache)(nil)
+)
+
+// NodeCacheStats counts a SizedNodeCache's use.
+type NodeCacheStats struct {
+	// Hits is the number of nodes found in the cache.
+	Hits uint64
+	// Misses is the number of nodes looked for but not found.
+	Misses uint64
+	// Evictions is the number of nodes removed to make room for others.
+	Evictions uint64
+	// Nodes is the number of nodes in the cache.
+	Nodes int
+	// Bytes is the total serialized size of the nodes in the cache.
+	Bytes int64
+}
+
+// NewSizedNodeCache creates a node cache that keeps nodes adding up to maxBytes when
+// serialized, and remembers up to maxPersisted nodes as persisted; 0 or less means use
+// DefaultPersistedKeys. A negative maxBytes is taken as 0, so no nodes are kept. One cache
+// can be shared by any number of trees.
+func NewSizedNodeCache(maxBytes int64, maxPersisted int) *SizedNodeCache {
+	if maxPersisted <= 0 {
+		maxPersisted = DefaultPersistedKeys
+	}
+	persisted, err := lru.New(maxPersisted)
+	if err != nil {
+		panic(err)
+	}
+	return &SizedNodeCache{
+		nodes:     sizedlru.New(maxBytes),
+		persisted: persisted,
+	}
+}
+
+// Add adds a node without knowing its size, so it is weighed by an estimate.
+func (c *SizedNodeCache) Add(key, value interface{}) {
+	c.addSized(key, value, estimatedNodeSize)
+}
+
+func (c *SizedNodeCache) addSized(key, value interface{}, size int) {
+	c.persisted.Add(key, nil)
+	evicted := c.nodes.Add(key, value, int64(size))
+	atomic.AddUint64(&c.evictions, uint64(evicted))
+}
+
+// Contains indicates the node with the given key has already been persisted, even if it
+// has since been evicted.
+func (c *SizedNodeCache) Contains(key interface{}) bool {
+	return c.persisted.Contains(key) || c.nodes.Contains(key)
+}
+
+func (c *SizedNodeCache) containsNode(key interface{}) bool {
+	return c.nodes.Contains(key)
+}
+
+// Get retrieves the already-deserialized node with the given key, if cached.
+func (c *SizedNodeCache) Get(key interface{}) (interface{}, bool) {
+	value, ok := c.nodes.Get(key)
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+	return value, ok
+}
+
+// Stats returns counts of the cache's use so far.
+func (c *SizedNodeCache) Stats() NodeCacheStats {
+	return NodeCacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Nodes:     c.nodes.Len(),
+		Bytes:     c.nodes.Bytes(),
+	}
+}
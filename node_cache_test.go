@@ -0,0 +1,170 @@
+package mast
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredNodeCache(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store := &countingStore{Persist: NewInMemoryStore()}
+	newConfig := func() *RemoteConfig {
+		cache, err := NewTieredNodeCache(16, dir, 1<<20)
+		require.NoError(t, err)
+		return &RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store, NodeCache: cache}
+	}
+	sum := func(m *Mast) int {
+		total := 0
+		require.NoError(t, m.Iter(ctx, func(_, v interface{}) error {
+			total += v.(int)
+			return nil
+		}))
+		return total
+	}
+
+	// stored nodes are cached on disk
+	m, err := NewRoot(&CreateRemoteOptions{BranchFactor: 4}).LoadMast(ctx, newConfig())
+	require.NoError(t, err)
+	for i := 0; i < 500; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	m, err = root.LoadMast(ctx, newConfig())
+	require.NoError(t, err)
+	require.Equal(t, 124750, sum(m))
+	require.Zero(t, store.loads)
+
+	// loaded nodes are cached on disk
+	require.NoError(t, os.RemoveAll(dir))
+	m, err = root.LoadMast(ctx, newConfig())
+	require.NoError(t, err)
+	require.Equal(t, 124750, sum(m))
+	loads := store.loads
+	require.NotZero(t, loads)
+	m, err = root.LoadMast(ctx, newConfig())
+	require.NoError(t, err)
+	require.Equal(t, 124750, sum(m))
+	require.Equal(t, loads, store.loads)
+
+	// damaged entries are loaded again
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			err = os.WriteFile(path, []byte("junk"), 0644)
+		}
+		return err
+	}))
+	m, err = root.LoadMast(ctx, newConfig())
+	require.NoError(t, err)
+	require.Equal(t, 124750, sum(m))
+	require.Equal(t, 2*loads, store.loads)
+	m, err = root.LoadMast(ctx, newConfig())
+	require.NoError(t, err)
+	require.Equal(t, 124750, sum(m))
+	require.Equal(t, 2*loads, store.loads)
+
+	// so are entries replaced by other well-formed nodes
+	var files []string
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	}))
+	require.Greater(t, len(files), 1)
+	other, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	for _, path := range files[1:] {
+		require.NoError(t, os.WriteFile(path, other, 0644))
+	}
+	m, err = root.LoadMast(ctx, newConfig())
+	require.NoError(t, err)
+	require.Equal(t, 124750, sum(m))
+	require.Equal(t, 3*loads-1, store.loads)
+	m, err = root.LoadMast(ctx, newConfig())
+	require.NoError(t, err)
+	require.Equal(t, 124750, sum(m))
+	require.Equal(t, 3*loads-1, store.loads)
+
+	// nodes on disk are still stored in a Persist that doesn't have them
+	config := newConfig()
+	config.StoreImmutablePartsWith = NewInMemoryStore()
+	m, err = NewRoot(&CreateRemoteOptions{BranchFactor: 4}).LoadMast(ctx, config)
+	require.NoError(t, err)
+	for i := 0; i < 500; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	stored, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, root, stored)
+	report, err := Verify(ctx, stored, config)
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Problems)
+}
+
+func TestSizedNodeCache(t *testing.T) {
+	t.Parallel()
+	const maxBytes = 2000
+	cache := NewSizedNodeCache(maxBytes, 0)
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: NewInMemoryStore(), NodeCache: cache}
+	m, err := NewRoot(&CreateRemoteOptions{BranchFactor: 4}).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	stats := cache.Stats()
+	require.NotZero(t, stats.Evictions)
+	require.LessOrEqual(t, stats.Bytes, int64(maxBytes))
+	require.NotZero(t, stats.Nodes)
+
+	// restoring evicted nodes doesn't store them again
+	stored := m.FlushStats().Nodes
+	require.NoError(t, m.Insert(ctx, 1000, 1000))
+	_, err = m.MakeRoot(ctx)
+	require.NoError(t, err)
+	require.Greater(t, m.FlushStats().Nodes, stored)
+	stored = m.FlushStats().Nodes
+	_, _, err = m.DeleteKey(ctx, 1000)
+	require.NoError(t, err)
+	restored, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, root, restored)
+	require.Equal(t, stored, m.FlushStats().Nodes)
+
+	// hits and misses are counted
+	cache = NewSizedNodeCache(1<<20, 0)
+	config.NodeCache = cache
+	m, err = root.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, m.Iter(ctx, func(_, _ interface{}) error { return nil }))
+	}
+	stats = cache.Stats()
+	require.Zero(t, stats.Evictions)
+	require.Equal(t, uint64(stats.Nodes), stats.Misses)
+	// the root, loaded by LoadMast, is hit by both iterations
+	require.Equal(t, stats.Misses+1, stats.Hits)
+}
+
+func TestSizedNodeCacheNegativeSizes(t *testing.T) {
+	t.Parallel()
+	cache := NewSizedNodeCache(-1, -1)
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: NewInMemoryStore(), NodeCache: cache}
+	m, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	report, err := Verify(ctx, root, &config)
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Problems)
+	require.Zero(t, cache.Stats().Nodes)
+}
@@ -0,0 +1,184 @@
+// Package cache wraps a Persist with a cache of the bytes it loads, for readers that can't
+// share a NodeCache.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jrhy/mast"
+	"github.com/jrhy/mast/internal/diskcache"
+	"github.com/jrhy/mast/internal/sizedlru"
+)
+
+// Options says where a Persist caches what it loads.
+type Options struct {
+	// MaxBytes is how many bytes may be cached in memory; 0 means none.
+	MaxBytes int64
+	// Dir, if set, is a directory to cache up to DirMaxBytes in. Any number of processes
+	// can share it.
+	Dir         string
+	DirMaxBytes int64
+}
+
+// Persist loads through a memory and/or directory cache in front of another Persist.
+// Concurrent loads of the same node are combined into one. Because nodes are immutable,
+// entries never need to be invalidated, except by Delete. List and Exists are forwarded to
+// the wrapped Persist, as mast.WrappedPersist describes.
+type Persist struct {
+	mast.WrappedPersist
+	mem  *sizedlru.Cache
+	disk *diskcache.Cache
+	l    sync.Mutex
+	// loads has the loads in progress, by name.
+	loads map[string]*load
+}
+
+var (
+	_ mast.Persist = &Persist{}
+	_ mast.Lister  = &Persist{}
+	_ mast.Deleter = &Persist{}
+	_ mast.Exister = &Persist{}
+)
+
+type load struct {
+	done chan struct{}
+	b    []byte
+	err  error
+}
+
+// NewPersist returns a Persist that caches what it loads from the given one, as the given
+// options say.
+func NewPersist(persist mast.Persist, options Options) (*Persist, error) {
+	p := &Persist{
+		WrappedPersist: mast.WrappedPersist{Persist: persist},
+		loads:          map[string]*load{},
+	}
+	if options.MaxBytes > 0 {
+		p.mem = sizedlru.New(options.MaxBytes)
+	}
+	if options.Dir != "" {
+		var err error
+		p.disk, err = diskcache.New(options.Dir, options.DirMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("disk cache: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Load returns the named bytes from the cache, or else loads them from the wrapped Persist,
+// waiting for a load of the same name already in progress rather than starting another.
+// The bytes returned may be shared, so must not be modified.
+func (p *Persist) Load(ctx context.Context, name string) ([]byte, error) {
+	if b, ok := p.cached(name); ok {
+		return b, nil
+	}
+	for {
+		p.l.Lock()
+		l, waiting := p.loads[name]
+		if !waiting {
+			l = &load{done: make(chan struct{})}
+			p.loads[name] = l
+		}
+		p.l.Unlock()
+		if !waiting {
+			l.b, l.err = p.loadThrough(ctx, name)
+			p.l.Lock()
+			delete(p.loads, name)
+			p.l.Unlock()
+			close(l.done)
+			return l.b, l.err
+		}
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if l.err != nil && ctx.Err() == nil &&
+			(errors.Is(l.err, context.Canceled) || errors.Is(l.err, context.DeadlineExceeded)) {
+			// the load was abandoned by its caller, but this one still wants it
+			continue
+		}
+		return l.b, l.err
+	}
+}
+
+func (p *Persist) cached(name string) ([]byte, bool) {
+	if p.mem != nil {
+		if b, ok := p.mem.Get(name); ok {
+			return b.([]byte), true
+		}
+	}
+	if p.disk != nil {
+		if b, ok := p.disk.Get(p.diskKey(name)); ok {
+			if p.mem != nil {
+				p.mem.Add(name, b, int64(len(b)))
+			}
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+func (p *Persist) loadThrough(ctx context.Context, name string) ([]byte, error) {
+	b, err := p.Persist.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	p.add(name, b)
+	return b, nil
+}
+
+// add caches the given bytes. The directory is only a cache, so failing to write to it
+// costs a load later.
+func (p *Persist) add(name string, b []byte) {
+	if p.mem != nil {
+		p.mem.Add(name, b, int64(len(b)))
+	}
+	if p.disk != nil {
+		_ = p.disk.Put(p.diskKey(name), b)
+	}
+}
+
+// diskKey distinguishes the wrapped Persist's nodes from others' in a shared directory.
+func (p *Persist) diskKey(name string) string {
+	return p.Persist.NodeURLPrefix() + "/" + name
+}
+
+// Store stores the given bytes in the wrapped Persist, and caches them.
+func (p *Persist) Store(ctx context.Context, name string, b []byte) error {
+	err := p.Persist.Store(ctx, name, b)
+	if err != nil {
+		return err
+	}
+	p.add(name, append([]byte(nil), b...))
+	return nil
+}
+
+// NodeURLPrefix returns the wrapped Persist's prefix, since the nodes are the same.
+func (p *Persist) NodeURLPrefix() string {
+	return p.Persist.NodeURLPrefix()
+}
+
+// Delete deletes the named item from the wrapped Persist, which must implement
+// mast.Deleter, and from the cache, so that this Persist can't load it afterwards.
+// Other Persists sharing the directory may still have it in memory.
+func (p *Persist) Delete(ctx context.Context, name string) error {
+	err := p.WrappedPersist.Delete(ctx, name)
+	if err != nil {
+		return err
+	}
+	if p.mem != nil {
+		p.mem.Remove(name)
+	}
+	if p.disk != nil {
+		err = p.disk.Remove(p.diskKey(name))
+		if err != nil {
+			return fmt.Errorf("disk cache: %w", err)
+		}
+	}
+	return nil
+}
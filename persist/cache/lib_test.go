@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jrhy/mast"
+	"github.com/jrhy/mast/persist/persisttest"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+// countingPersist counts loads by name, and holds them until released.
+type countingPersist struct {
+	mast.Persist
+	l       sync.Mutex
+	loads   map[string]int
+	release chan struct{}
+}
+
+func newCountingPersist() *countingPersist {
+	return &countingPersist{Persist: mast.NewInMemoryStore(), loads: map[string]int{}}
+}
+
+func (cp *countingPersist) Load(ctx context.Context, name string) ([]byte, error) {
+	cp.l.Lock()
+	cp.loads[name]++
+	release := cp.release
+	cp.l.Unlock()
+	if release != nil {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return cp.Persist.Load(ctx, name)
+}
+
+func (cp *countingPersist) total() int {
+	cp.l.Lock()
+	defer cp.l.Unlock()
+	total := 0
+	for _, n := range cp.loads {
+		total += n
+	}
+	return total
+}
+
+func TestConcurrentIterations(t *testing.T) {
+	store := newCountingPersist()
+	config := mast.RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store}
+	m, err := mast.NewRoot(&mast.CreateRemoteOptions{BranchFactor: 4}).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+
+	p, err := NewPersist(store, Options{MaxBytes: 1 << 20})
+	require.NoError(t, err)
+	type result struct {
+		count int
+		err   error
+	}
+	results := make(chan result)
+	for i := 0; i < 10; i++ {
+		go func() {
+			m, err := root.LoadMast(ctx, &mast.RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: p})
+			if err != nil {
+				results <- result{err: err}
+				return
+			}
+			count := 0
+			err = m.Iter(ctx, func(_, _ interface{}) error {
+				count++
+				return nil
+			})
+			results <- result{count, err}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		r := <-results
+		require.NoError(t, r.err)
+		require.Equal(t, 1000, r.count)
+	}
+	for name, n := range store.loads {
+		require.Equal(t, 1, n, name)
+	}
+}
+
+func TestSingleflight(t *testing.T) {
+	store := newCountingPersist()
+	require.NoError(t, store.Store(ctx, "a", []byte("apple")))
+	store.release = make(chan struct{})
+	p, err := NewPersist(store, Options{MaxBytes: 100})
+	require.NoError(t, err)
+
+	// a waiting load takes over from one whose caller gave up
+	leaderCtx, cancel := context.WithCancel(ctx)
+	leaderErr := make(chan error)
+	go func() {
+		_, err := p.Load(leaderCtx, "a")
+		leaderErr <- err
+	}()
+	require.Eventually(t, func() bool { return store.total() == 1 }, time.Second, time.Millisecond)
+	type result struct {
+		b   []byte
+		err error
+	}
+	results := make(chan result)
+	for i := 0; i < 5; i++ {
+		go func() {
+			b, err := p.Load(ctx, "a")
+			results <- result{b, err}
+		}()
+	}
+	cancel()
+	require.ErrorIs(t, <-leaderErr, context.Canceled)
+	require.Eventually(t, func() bool { return store.total() == 2 }, time.Second, time.Millisecond)
+	close(store.release)
+	for i := 0; i < 5; i++ {
+		r := <-results
+		require.NoError(t, r.err)
+		require.Equal(t, []byte("apple"), r.b)
+	}
+	_, err = p.Load(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, 2, store.total())
+}
+
+func TestDirectory(t *testing.T) {
+	dir := t.TempDir()
+	store := newCountingPersist()
+	p, err := NewPersist(store, Options{Dir: dir, DirMaxBytes: 1 << 20})
+	require.NoError(t, err)
+	require.NoError(t, p.Store(ctx, "a", []byte("apple")))
+	require.NoError(t, store.Store(ctx, "b", []byte("banana")))
+	b, err := p.Load(ctx, "b")
+	require.NoError(t, err)
+	require.Equal(t, []byte("banana"), b)
+	require.Equal(t, 1, store.total())
+
+	p, err = NewPersist(store, Options{Dir: dir, DirMaxBytes: 1 << 20, MaxBytes: 100})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		b, err = p.Load(ctx, "a")
+		require.NoError(t, err)
+		require.Equal(t, []byte("apple"), b)
+		b, err = p.Load(ctx, "b")
+		require.NoError(t, err)
+		require.Equal(t, []byte("banana"), b)
+	}
+	require.Equal(t, 1, store.total())
+	_, err = p.Load(ctx, "c")
+	require.Error(t, err)
+}
+
+func TestWrapper(t *testing.T) {
+	persisttest.Wrapper(t, func(store mast.Persist) mast.Persist {
+		p, err := NewPersist(store, Options{MaxBytes: 1 << 20, Dir: t.TempDir(), DirMaxBytes: 1 << 20})
+		require.NoError(t, err)
+		return p
+	})
+}
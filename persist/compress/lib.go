@@ -0,0 +1,189 @@
+// Package compress wraps a Persist so that what is stored is compressed. Nodes are still
+// named by the hash of their uncompressed bytes, so trees are the same with or without it.
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/jrhy/mast"
+)
+
+// Uncompressed is the header byte of payloads stored as they are, because compressing
+// them didn't make them smaller.
+const Uncompressed = 0
+
+// Codec compresses and decompresses payloads. A Codec implementing zstd, for example, can
+// be used alongside the standard library's that are built in.
+type Codec interface {
+	// ID identifies the codec in the header byte of what it compresses. IDs below 16 are
+	// reserved for this package's codecs.
+	ID() byte
+	// Compress returns the compressed form of the given bytes. The same bytes should
+	// always compress to the same result.
+	Compress(b []byte) ([]byte, error)
+	// Decompress returns the bytes that compressed to the given ones.
+	Decompress(b []byte) ([]byte, error)
+}
+
+// Persist compresses what it stores in, and decompresses what it loads from, another
+// Persist. Every stored payload starts with a header byte identifying how it was
+// compressed, so a Persist written through one codec can be read through another, but
+// one written without this package can't be read through it. List, Delete and Exists are
+// forwarded to the wrapped Persist, as mast.WrappedPersist describes.
+type Persist struct {
+	mast.WrappedPersist
+	codec  Codec
+	codecs map[byte]Codec
+}
+
+var (
+	_ mast.Persist = &Persist{}
+	_ mast.Lister  = &Persist{}
+	_ mast.Deleter = &Persist{}
+	_ mast.Exister = &Persist{}
+)
+
+// NewPersist returns a Persist that compresses with the given codec what it stores in the
+// given Persist. It can load what was compressed by the given codec, the other given ones,
+// and this package's.
+func NewPersist(persist mast.Persist, codec Codec, others ...Codec) *Persist {
+	p := &Persist{
+		WrappedPersist: mast.WrappedPersist{Persist: persist},
+		codec:          codec,
+		codecs:         map[byte]Codec{},
+	}
+	for _, c := range append([]Codec{Flate(flate.DefaultCompression), Gzip(gzip.DefaultCompression), codec}, others...) {
+		p.codecs[c.ID()] = c
+	}
+	return p
+}
+
+// Store compresses the given bytes and stores them by the given name.
+func (p *Persist) Store(ctx context.Context, name string, b []byte) error {
+	compressed, err := p.codec.Compress(b)
+	if err != nil {
+		return fmt.Errorf("compress: %w", err)
+	}
+	var payload []byte
+	if len(compressed) < len(b) {
+		payload = append([]byte{p.codec.ID()}, compressed...)
+	} else {
+		payload = append([]byte{Uncompressed}, b...)
+	}
+	return p.Persist.Store(ctx, name, payload)
+}
+
+// Load loads the named bytes and decompresses them.
+func (p *Persist) Load(ctx context.Context, name string) ([]byte, error) {
+	payload, err := p.Persist.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("%s: no compression header", name)
+	}
+	if payload[0] == Uncompressed {
+		return payload[1:], nil
+	}
+	codec, ok := p.codecs[payload[0]]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown compression codec %d", name, payload[0])
+	}
+	b, err := codec.Decompress(payload[1:])
+	if err != nil {
+		return nil, fmt.Errorf("%s: decompress: %w", name, err)
+	}
+	return b, nil
+}
+
+// NodeURLPrefix returns the wrapped Persist's prefix, since the nodes are the same.
+func (p *Persist) NodeURLPrefix() string {
+	return p.Persist.NodeURLPrefix()
+}
+
+const (
+	flateID = 1
+	gzipID  = 2
+)
+
+// writer is implemented by flate.Writer and gzip.Writer.
+type writer interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+// streamCodec compresses with reusable writers.
+type streamCodec struct {
+	id        byte
+	writers   *sync.Pool
+	newReader func(io.Reader) (io.ReadCloser, error)
+}
+
+func (c streamCodec) ID() byte {
+	return c.id
+}
+
+func (c streamCodec) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := c.writers.Get().(writer)
+	defer c.writers.Put(w)
+	w.Reset(&buf)
+	_, err := w.Write(b)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c streamCodec) Decompress(b []byte) ([]byte, error) {
+	r, err := c.newReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// newStreamCodec returns a codec with the given ID, checking that writers can be made.
+func newStreamCodec(
+	id byte,
+	newWriter func() (writer, error),
+	newReader func(io.Reader) (io.ReadCloser, error),
+) Codec {
+	w, err := newWriter()
+	if err != nil {
+		panic(err)
+	}
+	writers := &sync.Pool{New: func() interface{} {
+		w, _ := newWriter()
+		return w
+	}}
+	writers.Put(w)
+	return streamCodec{id, writers, newReader}
+}
+
+// Flate returns a codec using DEFLATE at the given level, as accepted by
+// compress/flate.NewWriter. Panics if the level is invalid.
+func Flate(level int) Codec {
+	return newStreamCodec(flateID,
+		func() (writer, error) { return flate.NewWriter(nil, level) },
+		func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil })
+}
+
+// Gzip returns a codec using gzip at the given level, as accepted by
+// compress/gzip.NewWriterLevel. Panics if the level is invalid.
+func Gzip(level int) Codec {
+	return newStreamCodec(gzipID,
+		func() (writer, error) { return gzip.NewWriterLevel(nil, level) },
+		func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) })
+}
@@ -0,0 +1,110 @@
+package compress
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jrhy/mast"
+	"github.com/jrhy/mast/persist/persisttest"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+// reverseCodec stands in for codecs from outside this package.
+type reverseCodec struct{}
+
+func (reverseCodec) ID() byte { return 100 }
+
+func (reverseCodec) Compress(b []byte) ([]byte, error) {
+	r := make([]byte, len(b)/2)
+	for i := range r {
+		r[i] = b[len(b)-1-i]
+	}
+	return r, nil
+}
+
+func (reverseCodec) Decompress(b []byte) ([]byte, error) {
+	return nil, fmt.Errorf("lossy")
+}
+
+// storedBytes totals the size in the given store of everything the given Lister lists.
+func storedBytes(t *testing.T, lister mast.Lister, store mast.Persist) int {
+	total := 0
+	require.NoError(t, lister.List(ctx, "", func(name string, _ time.Time) error {
+		b, err := store.Load(ctx, name)
+		total += len(b)
+		return err
+	}))
+	return total
+}
+
+func TestTree(t *testing.T) {
+	build := func(p mast.Persist) *mast.Root {
+		config := mast.RemoteConfig{KeysLike: "", ValuesLike: "", StoreImmutablePartsWith: p, VerifyNodes: true}
+		m, err := mast.NewRoot(nil).LoadMast(ctx, &config)
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, m.Insert(ctx, fmt.Sprintf("user/%08d", i), fmt.Sprintf("name-%d", i)))
+		}
+		root, err := m.MakeRoot(ctx)
+		require.NoError(t, err)
+		m, err = root.LoadMast(ctx, &config)
+		require.NoError(t, err)
+		var value string
+		found, err := m.Get(ctx, "user/00000500", &value)
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, "name-500", value)
+		return root
+	}
+	plain := mast.NewInMemoryStore()
+	expected := build(plain)
+	for _, codec := range []Codec{Flate(1), Flate(9), Gzip(5)} {
+		store := mast.NewInMemoryStore()
+		p := NewPersist(store, codec)
+		require.Equal(t, expected, build(p))
+		require.Less(t, storedBytes(t, p, store), storedBytes(t, plain.(mast.Lister), plain)/2)
+	}
+}
+
+func TestWrapper(t *testing.T) {
+	persisttest.Wrapper(t, func(store mast.Persist) mast.Persist {
+		return NewPersist(store, Gzip(9))
+	})
+}
+
+func TestHeader(t *testing.T) {
+	store := mast.NewInMemoryStore()
+	p := NewPersist(store, Gzip(9))
+	require.NoError(t, p.Store(ctx, "text", []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")))
+	require.NoError(t, p.Store(ctx, "short", []byte("a")))
+	b, err := store.Load(ctx, "text")
+	require.NoError(t, err)
+	require.Equal(t, byte(gzipID), b[0])
+	b, err = store.Load(ctx, "short")
+	require.NoError(t, err)
+	require.Equal(t, []byte{Uncompressed, 'a'}, b)
+
+	// readers detect the codec
+	other := NewPersist(store, Flate(1))
+	for name, expected := range map[string]string{"text": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "short": "a"} {
+		b, err = other.Load(ctx, name)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(b))
+	}
+
+	// other codecs must be given to be read
+	require.NoError(t, NewPersist(store, reverseCodec{}).Store(ctx, "reversed", []byte("abcd")))
+	_, err = other.Load(ctx, "reversed")
+	require.EqualError(t, err, "reversed: unknown compression codec 100")
+	_, err = NewPersist(store, Flate(1), reverseCodec{}).Load(ctx, "reversed")
+	require.EqualError(t, err, "reversed: decompress: lossy")
+
+	require.NoError(t, store.Store(ctx, "empty", nil))
+	_, err = other.Load(ctx, "empty")
+	require.Error(t, err)
+	require.Panics(t, func() { Flate(100) })
+}
@@ -2,8 +2,11 @@ package file
 
 import (
 	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/jrhy/mast"
 )
@@ -14,7 +17,12 @@ type Persist struct {
 	basepath string
 }
 
-var _ mast.Persist = Persist{}
+var (
+	_ mast.Persist = Persist{}
+	_ mast.Lister  = Persist{}
+	_ mast.Deleter = Persist{}
+	_ mast.Exister = Persist{}
+)
 
 // Load loads the bytes persisted in the named file.
 func (p Persist) Load(ctx context.Context, name string) ([]byte, error) {
@@ -22,14 +30,64 @@ func (p Persist) Load(ctx context.Context, name string) ([]byte, error) {
 }
 
 // Store persists the given bytes in a file of the given name, if it
-// doesn't exist already.
+// doesn't exist already. Otherwise, the file's modification time is
+// updated, so that mast.CollectGarbage's grace period protects it as
+// newly stored.
 func (p Persist) Store(ctx context.Context, name string, bytes []byte) error {
 	path := filepath.Join(p.basepath, name)
 	_, err := os.Stat(path)
 	if os.IsNotExist(err) {
 		return os.WriteFile(filepath.Join(p.basepath, name), bytes, 0644)
 	}
-	return nil
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// List invokes the callback with the name and modification time of every file under the
+// Persist's directory whose name starts with the given prefix.
+func (p Persist) List(ctx context.Context, prefix string, fn func(string, time.Time) error) error {
+	return filepath.WalkDir(p.basepath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(p.basepath, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(name, info.ModTime())
+	})
+}
+
+// Delete removes the named file, if it exists.
+func (p Persist) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(p.basepath, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Exists indicates the named file exists.
+func (p Persist) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(p.basepath, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 // NewPersistForPath returns a Persist that loads and stores nodes as
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -30,3 +31,50 @@ func TestFiles(t *testing.T) {
 		fmt.Println("temp directory:", dir)
 	}
 }
+
+func TestListAndDelete(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := NewPersistForPath(dir)
+	for _, name := range []string{"a1", "a2", "b1"} {
+		require.NoError(t, p.Store(ctx, name, []byte(name)))
+	}
+	list := func(prefix string) []string {
+		var names []string
+		require.NoError(t, p.List(ctx, prefix, func(name string, modified time.Time) error {
+			require.False(t, modified.IsZero())
+			names = append(names, name)
+			return nil
+		}))
+		return names
+	}
+	require.Equal(t, []string{"a1", "a2", "b1"}, list(""))
+	require.Equal(t, []string{"a1", "a2"}, list("a"))
+
+	exists, err := p.Exists(ctx, "a1")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.NoError(t, p.Delete(ctx, "a1"))
+	require.NoError(t, p.Delete(ctx, "a1"))
+	exists, err = p.Exists(ctx, "a1")
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, []string{"a2", "b1"}, list(""))
+	_, err = p.Load(ctx, "a1")
+	require.Error(t, err)
+}
+
+func TestStoreRefreshesModified(t *testing.T) {
+	dir := t.TempDir()
+	p := NewPersistForPath(dir)
+	require.NoError(t, p.Store(ctx, "a", []byte("a")))
+	old := time.Now().Add(-24 * time.Hour)
+	require.NoError(t, os.Chtimes(dir+"/a", old, old))
+	require.NoError(t, p.Store(ctx, "a", []byte("a")))
+	require.NoError(t, p.List(ctx, "a", func(name string, modified time.Time) error {
+		require.True(t, modified.After(old.Add(time.Hour)), "%v", modified)
+		return nil
+	}))
+}
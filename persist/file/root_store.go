@@ -0,0 +1,106 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jrhy/mast"
+)
+
+// RootStore implements the mast.RootStore interface, keeping each named root as a JSON
+// file in a directory.
+type RootStore struct {
+	basepath string
+}
+
+var _ mast.RootStore = RootStore{}
+
+// NewRootStoreForPath returns a RootStore that keeps roots as files in the directory at the
+// given path.
+//
+// CompareAndSwap holds a lock file, "<name>.lock", while it checks and replaces the root; if a
+// process dies holding it, the lock file has to be removed by hand.
+func NewRootStoreForPath(path string) RootStore {
+	return RootStore{path}
+}
+
+// lockRetryInterval is how long CompareAndSwap waits before retrying a held lock.
+const lockRetryInterval = 10 * time.Millisecond
+
+// Get returns the root in the named file, or nil if there isn't one.
+func (rs RootStore) Get(ctx context.Context, name string) (*mast.Root, error) {
+	b, err := os.ReadFile(filepath.Join(rs.basepath, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var root mast.Root
+	err = json.Unmarshal(b, &root)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", name, err)
+	}
+	return &root, nil
+}
+
+// CompareAndSwap replaces the named file with new, if it currently has old, or returns
+// mast.ErrRootConflict. The file is replaced atomically by renaming a temporary file over it.
+func (rs RootStore) CompareAndSwap(ctx context.Context, name string, old, new *mast.Root) error {
+	if new == nil {
+		return errors.New("cannot swap in a nil root")
+	}
+	b, err := json.Marshal(new)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	unlock, err := rs.lock(ctx, name)
+	if err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	defer unlock()
+	current, err := rs.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !current.Equal(old) {
+		return mast.ErrRootConflict
+	}
+	path := filepath.Join(rs.basepath, name)
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// lock creates the name's lock file, waiting for any other holder to remove it first.
+func (rs RootStore) lock(ctx context.Context, name string) (func(), error) {
+	path := filepath.Join(rs.basepath, name+".lock")
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jrhy/mast"
+	"github.com/jrhy/mast/persist/persisttest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootStore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rs := NewRootStoreForPath(dir)
+	persisttest.RootStore(t, rs)
+
+	// a held lock blocks until the context is done
+	head, err := rs.Get(ctx, "main")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.lock"), nil, 0644))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err = rs.CompareAndSwap(timeoutCtx, "main", head, mast.NewRoot(nil))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,117 @@
+package httppersist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jrhy/mast"
+)
+
+// Client reads nodes and roots from a server running NewHandler. It implements
+// mast.Persist, for loading trees directly from the server, but cannot store nodes.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+var _ mast.Persist = &Client{}
+
+// NewClient returns a Client for the handler served at the given URL. A nil httpClient
+// means use http.DefaultClient.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Load loads the named node from the server.
+func (c *Client) Load(ctx context.Context, name string) ([]byte, error) {
+	b, err := c.get(ctx, "node", name)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, fmt.Errorf("node %s: %w", name, mast.ErrNotFound)
+	}
+	return b, nil
+}
+
+// Store fails, since the server is read-only.
+func (c *Client) Store(ctx context.Context, name string, b []byte) error {
+	return errors.New("cannot store nodes over http")
+}
+
+// NodeURLPrefix returns the server's URL.
+func (c *Client) NodeURLPrefix() string {
+	return c.baseURL
+}
+
+// Root returns the server's root with the given name, or nil if there isn't one.
+func (c *Client) Root(ctx context.Context, name string) (*mast.Root, error) {
+	b, err := c.get(ctx, "root", name)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	var root mast.Root
+	err = json.Unmarshal(b, &root)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal root: %w", err)
+	}
+	return &root, nil
+}
+
+// Reconcile copies the nodes of the server's named root that are missing from the given
+// Persist, and returns the root, so that it can be loaded locally to diff or merge with
+// local trees. Starting from the root's hash, only links whose nodes are missing locally
+// are followed, so trees that mostly agree are reconciled by pulling only the nodes that
+// differ. Returns nil if the server has no such root.
+func (c *Client) Reconcile(ctx context.Context, name string, local mast.Persist, options *mast.SyncOptions) (*mast.Root, error) {
+	root, err := c.Root(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("root: %w", err)
+	}
+	if root == nil {
+		return nil, nil
+	}
+	_, err = mast.Sync(ctx, root, c, local, options)
+	if err != nil {
+		return nil, fmt.Errorf("sync: %w", err)
+	}
+	return root, nil
+}
+
+// get returns the body at the given path, or nil if the handler says it doesn't exist.
+// Other 404s are errors, since they mean the path isn't served by the handler.
+func (c *Client) get(ctx context.Context, kind, name string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/%s/%s", c.baseURL, kind, url.PathEscape(name)), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && resp.Header.Get(NotFoundHeader) != "" {
+		return nil, nil
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s %s: %s: %s", kind, name, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
@@ -0,0 +1,76 @@
+package httppersist
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/jrhy/mast"
+)
+
+// NotFoundHeader is set by the handler on its responses for nodes and roots that don't
+// exist, so that Clients can tell them from other 404s, such as for a wrong base URL.
+const NotFoundHeader = "Mast-Not-Found"
+
+// NewHandler returns an http.Handler that serves the nodes in the given Persist at
+// "node/<name>", and the roots in the given RootStore at "root/<name>", for Clients to
+// reconcile against. Mount it with http.StripPrefix to serve it under a path. If roots is
+// nil, only nodes are served, and every root is not found.
+func NewHandler(persist mast.Persist, roots mast.RootStore) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /node/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if !validName(name) {
+			http.Error(w, "bad node name", http.StatusBadRequest)
+			return
+		}
+		b, err := persist.Load(r.Context(), name)
+		if mast.IsNotFound(err) {
+			notFound(w, "node not found")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		// nodes are named by their content, so never change
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Write(b)
+	})
+	mux.HandleFunc("GET /root/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if !validName(name) {
+			http.Error(w, "bad root name", http.StatusBadRequest)
+			return
+		}
+		if roots == nil {
+			notFound(w, "root not found")
+			return
+		}
+		root, err := roots.Get(r.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if root == nil {
+			notFound(w, "root not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		json.NewEncoder(w).Encode(root)
+	})
+	return mux
+}
+
+// notFound responds that what was asked for doesn't exist.
+func notFound(w http.ResponseWriter, message string) {
+	w.Header().Set(NotFoundHeader, "1")
+	http.Error(w, message, http.StatusNotFound)
+}
+
+// validName rejects names that could escape the store they are looked up in.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
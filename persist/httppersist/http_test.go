@@ -0,0 +1,163 @@
+package httppersist_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jrhy/mast"
+	"github.com/jrhy/mast/persist/httppersist"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	remoteStore := mast.NewInMemoryStore()
+	remoteRoots := mast.NewInMemoryRootStore()
+	server := httptest.NewServer(http.StripPrefix("/mast", httppersist.NewHandler(remoteStore, remoteRoots)))
+	t.Cleanup(server.Close)
+	client := httppersist.NewClient(server.URL+"/mast/", server.Client())
+
+	remoteConfig := mast.RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: remoteStore}
+	update := func(f func(*mast.Mast) error) {
+		_, err := mast.Update(ctx, remoteRoots, "main", &remoteConfig, f, nil)
+		require.NoError(t, err)
+	}
+	update(func(m *mast.Mast) error {
+		for i := 0; i < 1000; i++ {
+			err := m.Insert(ctx, i, i)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	root, err := client.Root(ctx, "missing")
+	require.NoError(t, err)
+	require.Nil(t, root)
+	_, err = client.Load(ctx, "missing")
+	require.Error(t, err)
+
+	localStore := mast.NewInMemoryStore()
+	localConfig := mast.RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: localStore}
+	var progress mast.SyncProgress
+	options := mast.SyncOptions{Progress: func(p mast.SyncProgress) { progress = p }}
+	root, err = client.Reconcile(ctx, "main", localStore, &options)
+	require.NoError(t, err)
+	require.NotZero(t, progress.Copied)
+	first := progress
+	report, err := mast.Verify(ctx, root, &localConfig)
+	require.NoError(t, err)
+	require.True(t, report.OK(), report.Problems)
+
+	// a local replica that diverged reconciles with the remote's changes
+	local, err := root.LoadMast(ctx, &localConfig)
+	require.NoError(t, err)
+	require.NoError(t, local.Insert(ctx, 2000, 2000))
+	update(func(m *mast.Mast) error { return m.Insert(ctx, 500, -1) })
+
+	progress = mast.SyncProgress{}
+	newRoot, err := client.Reconcile(ctx, "main", localStore, &options)
+	require.NoError(t, err)
+	require.Less(t, progress.Copied, first.Copied)
+	remote, err := newRoot.LoadMast(ctx, &localConfig)
+	require.NoError(t, err)
+	var diffs []interface{}
+	require.NoError(t, remote.DiffIter(ctx, local, func(added, removed bool, key, addedValue, removedValue interface{}) (bool, error) {
+		diffs = append(diffs, key)
+		return true, nil
+	}))
+	require.Equal(t, []interface{}{500, 2000}, diffs)
+
+	// the client can also load trees directly
+	direct, err := newRoot.LoadMast(ctx, &mast.RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: client})
+	require.NoError(t, err)
+	var v int
+	found, err := direct.Get(ctx, 500, &v)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, -1, v)
+}
+
+func TestHandlerRejectsBadNames(t *testing.T) {
+	t.Parallel()
+	handler := httppersist.NewHandler(mast.NewInMemoryStore(), mast.NewInMemoryRootStore())
+	for _, path := range []string{"/root/..%2Fetc", "/node/a%5Cb"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+}
+
+// brokenStore fails every load.
+type brokenStore struct {
+	mast.Persist
+}
+
+func (brokenStore) Load(context.Context, string) ([]byte, error) {
+	return nil, errors.New("disk on fire")
+}
+
+func TestHandlerStatuses(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	for _, tc := range []struct {
+		handler http.Handler
+		path    string
+		status  int
+	}{
+		{httppersist.NewHandler(mast.NewInMemoryStore(), nil), "/node/missing", http.StatusNotFound},
+		{httppersist.NewHandler(brokenStore{mast.NewInMemoryStore()}, nil), "/node/any", http.StatusInternalServerError},
+		{httppersist.NewHandler(mast.NewInMemoryStore(), nil), "/root/main", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		tc.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		require.Equal(t, tc.status, w.Code, tc.path)
+	}
+
+	server := httptest.NewServer(httppersist.NewHandler(brokenStore{mast.NewInMemoryStore()}, nil))
+	t.Cleanup(server.Close)
+	client := httppersist.NewClient(server.URL, server.Client())
+	_, err := client.Load(ctx, "any")
+	require.ErrorContains(t, err, "disk on fire")
+	require.False(t, mast.IsNotFound(err))
+	server = httptest.NewServer(httppersist.NewHandler(mast.NewInMemoryStore(), nil))
+	t.Cleanup(server.Close)
+	client = httppersist.NewClient(server.URL, server.Client())
+	_, err = client.Load(ctx, "missing")
+	require.True(t, mast.IsNotFound(err), "%v", err)
+	root, err := client.Root(ctx, "main")
+	require.NoError(t, err)
+	require.Nil(t, root)
+}
+
+func TestClientWrongPrefix(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	roots := mast.NewInMemoryRootStore()
+	require.NoError(t, roots.CompareAndSwap(ctx, "main", nil, mast.NewRoot(nil)))
+	server := httptest.NewServer(http.StripPrefix("/mast", httppersist.NewHandler(mast.NewInMemoryStore(), roots)))
+	t.Cleanup(server.Close)
+
+	client := httppersist.NewClient(server.URL+"/wrong/", server.Client())
+	root, err := client.Root(ctx, "main")
+	require.ErrorContains(t, err, "404")
+	require.Nil(t, root)
+	_, err = client.Reconcile(ctx, "main", mast.NewInMemoryStore(), nil)
+	require.Error(t, err)
+	_, err = client.Load(ctx, "missing")
+	require.Error(t, err)
+	require.False(t, mast.IsNotFound(err), "%v", err)
+
+	client = httppersist.NewClient(server.URL+"/mast/", server.Client())
+	root, err = client.Root(ctx, "main")
+	require.NoError(t, err)
+	require.NotNil(t, root)
+	root, err = client.Root(ctx, "missing")
+	require.NoError(t, err)
+	require.Nil(t, root)
+}
@@ -0,0 +1,74 @@
+// Package persisttest has tests that Persists and RootStores from different packages share.
+package persisttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jrhy/mast"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+// Wrapper tests a Persist that wraps another, made by the given function, checking that
+// CollectGarbage and Sync work through it, as they do when it embeds mast.WrappedPersist.
+func Wrapper(t *testing.T, wrap func(mast.Persist) mast.Persist) {
+	store := mast.NewInMemoryStore()
+	p := wrap(store)
+	require.Implements(t, (*mast.Lister)(nil), p)
+	require.Implements(t, (*mast.Deleter)(nil), p)
+	require.Implements(t, (*mast.Exister)(nil), p)
+	config := mast.RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: p}
+	m, err := mast.NewRoot(&mast.CreateRemoteOptions{BranchFactor: 4}).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	_, err = m.MakeRoot(ctx)
+	require.NoError(t, err)
+	require.NoError(t, m.Insert(ctx, 0, -1))
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+
+	result, err := mast.CollectGarbage(ctx, &config, []*mast.Root{root}, mast.GCOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, result.Collected)
+	for _, name := range result.Collected {
+		exists, err := p.(mast.Exister).Exists(ctx, name)
+		require.NoError(t, err)
+		require.False(t, exists, name)
+		_, err = p.Load(ctx, name)
+		require.True(t, mast.IsNotFound(err), "deleted node %s should not load: %v", name, err)
+	}
+	exists, err := p.(mast.Exister).Exists(ctx, *root.Link)
+	require.NoError(t, err)
+	require.True(t, exists)
+	report, err := mast.Verify(ctx, root, &config)
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Problems)
+
+	// to and from the wrapper
+	to := wrap(mast.NewInMemoryStore())
+	progress, err := mast.Sync(ctx, root, p, to, nil)
+	require.NoError(t, err)
+	require.Equal(t, report.Nodes, progress.Copied)
+	progress, err = mast.Sync(ctx, root, p, to, nil)
+	require.NoError(t, err)
+	require.Zero(t, progress.Copied)
+	report, err = mast.Verify(ctx, root, &mast.RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: to})
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Problems)
+
+	// without the optional interfaces
+	p = wrap(struct{ mast.Persist }{store})
+	require.Error(t, p.(mast.Lister).List(ctx, "", func(string, time.Time) error { return nil }))
+	require.Error(t, p.(mast.Deleter).Delete(ctx, *root.Link))
+	exists, err = p.(mast.Exister).Exists(ctx, *root.Link)
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = p.(mast.Exister).Exists(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
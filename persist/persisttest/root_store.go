@@ -0,0 +1,66 @@
+package persisttest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/jrhy/mast"
+	"github.com/stretchr/testify/require"
+)
+
+// RootStore tests that the given empty RootStore behaves as mast.RootStore says.
+func RootStore(t *testing.T, rs mast.RootStore) {
+	root, err := rs.Get(ctx, "main")
+	require.NoError(t, err)
+	require.Nil(t, root)
+
+	empty := mast.NewRoot(nil)
+	require.Error(t, rs.CompareAndSwap(ctx, "main", nil, nil))
+	require.NoError(t, rs.CompareAndSwap(ctx, "main", nil, empty))
+	require.ErrorIs(t, rs.CompareAndSwap(ctx, "main", nil, empty), mast.ErrRootConflict)
+	head, err := rs.Get(ctx, "main")
+	require.NoError(t, err)
+	require.True(t, head.Equal(empty))
+
+	// writers racing from the same head: exactly one wins
+	link := "abc"
+	newRoots := make([]*mast.Root, 10)
+	for i := range newRoots {
+		newRoots[i] = &mast.Root{Link: &link, Size: uint64(i + 1), BranchFactor: 16}
+	}
+	wg := sync.WaitGroup{}
+	results := make([]error, len(newRoots))
+	for i := range newRoots {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = rs.CompareAndSwap(ctx, "main", head, newRoots[i])
+		}(i)
+	}
+	wg.Wait()
+	winners := 0
+	for i, err := range results {
+		if err == nil {
+			winners++
+			newHead, err := rs.Get(ctx, "main")
+			require.NoError(t, err)
+			require.True(t, newHead.Equal(newRoots[i]))
+		} else {
+			require.ErrorIs(t, err, mast.ErrRootConflict)
+		}
+	}
+	require.Equal(t, 1, winners)
+
+	// roots returned are the caller's to change
+	newHead, err := rs.Get(ctx, "main")
+	require.NoError(t, err)
+	*newHead.Link = "changed by caller"
+	again, err := rs.Get(ctx, "main")
+	require.NoError(t, err)
+	require.Equal(t, "abc", *again.Link)
+	require.ErrorIs(t, rs.CompareAndSwap(ctx, "main", newHead, empty), mast.ErrRootConflict)
+
+	other, err := rs.Get(ctx, "other")
+	require.NoError(t, err)
+	require.Nil(t, other)
+}
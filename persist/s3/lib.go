@@ -3,10 +3,14 @@ package s3
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/jrhy/mast"
@@ -18,6 +22,18 @@ type S3Interface interface {
 	PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error)
 }
 
+// S3Lister is implemented by S3 clients that can list objects, such as *s3.S3. Persist
+// needs it for List.
+type S3Lister interface {
+	ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error
+}
+
+// S3Header is implemented by S3 clients that can get objects' metadata, such as *s3.S3.
+// Persist uses it for Exists, if available, to avoid downloading objects.
+type S3Header interface {
+	HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error)
+}
+
 // Persist implements the mast.Persist interface for storing and loading
 // nodes from files.
 type Persist struct {
@@ -28,7 +44,12 @@ type Persist struct {
 	nodeURLPrefix string
 }
 
-var _ mast.Persist = &Persist{}
+var (
+	_ mast.Persist = &Persist{}
+	_ mast.Lister  = Persist{}
+	_ mast.Deleter = Persist{}
+	_ mast.Exister = Persist{}
+)
 
 // Load loads the bytes persisted in the named object.
 func (p *Persist) Load(ctx context.Context, name string) ([]byte, error) {
@@ -38,8 +59,12 @@ func (p *Persist) Load(ctx context.Context, name string) ([]byte, error) {
 	}
 	output, err := p.s3.GetObjectWithContext(ctx, &input)
 	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%s: %w", name, mast.ErrNotFound)
+		}
 		return nil, err
 	}
+	defer output.Body.Close()
 	b, err := io.ReadAll(output.Body)
 	if err != nil {
 		return nil, err
@@ -62,6 +87,72 @@ func (p Persist) Store(ctx context.Context, name string, b []byte) error {
 	return nil
 }
 
+// List invokes the callback with the name and last-modified time of every object under the
+// Persist's prefix plus the given prefix. The S3 client must implement S3Lister.
+func (p Persist) List(ctx context.Context, prefix string, fn func(string, time.Time) error) error {
+	lister, ok := p.s3.(S3Lister)
+	if !ok {
+		return fmt.Errorf("%T does not implement S3Lister", p.s3)
+	}
+	input := s3.ListObjectsV2Input{
+		Bucket: &p.BucketName,
+		Prefix: aws.String(p.Prefix + prefix),
+	}
+	var cbErr error
+	err := lister.ListObjectsV2PagesWithContext(ctx, &input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			cbErr = fn(strings.TrimPrefix(aws.StringValue(object.Key), p.Prefix), aws.TimeValue(object.LastModified))
+			if cbErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return cbErr
+}
+
+// Delete deletes the named object.
+func (p Persist) Delete(ctx context.Context, name string) error {
+	input := s3.DeleteObjectInput{
+		Bucket: &p.BucketName,
+		Key:    aws.String(p.Prefix + name),
+	}
+	_, err := p.s3.DeleteObjectWithContext(ctx, &input)
+	return err
+}
+
+// Exists indicates the named object exists, using HEAD requests if the S3 client
+// implements S3Header.
+func (p Persist) Exists(ctx context.Context, name string) (bool, error) {
+	header, ok := p.s3.(S3Header)
+	if !ok {
+		_, err := p.Load(ctx, name)
+		if mast.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	input := s3.HeadObjectInput{
+		Bucket: &p.BucketName,
+		Key:    aws.String(p.Prefix + name),
+	}
+	_, err := header.HeadObjectWithContext(ctx, &input)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// isNotFound indicates the error is S3's for a missing object. HEAD responses have no
+// body, so only have the generic code.
+func isNotFound(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound")
+}
+
 // NewPersist returns a Persist that loads and stores nodes as
 // objects with the given S3 client and bucket name.
 func NewPersist(client S3Interface, endpointURL, bucketName, prefix string) Persist {
@@ -3,7 +3,10 @@ package s3_test
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/jrhy/mast"
+	"github.com/jrhy/mast/persist/persisttest"
 	s3Persist "github.com/jrhy/mast/persist/s3"
 	"github.com/jrhy/mast/persist/s3test"
 	"github.com/stretchr/testify/require"
@@ -22,3 +25,46 @@ func TestHappyCase(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, b, []byte("here is some stuff"))
 }
+
+func TestListAndDelete(t *testing.T) {
+	t.Parallel()
+	c, bucketName, closer := s3test.Client()
+	t.Cleanup(closer)
+
+	ctx := context.Background()
+	p := s3Persist.NewPersist(c, c.Endpoint, bucketName, "node/")
+	other := s3Persist.NewPersist(c, c.Endpoint, bucketName, "other/")
+	for _, name := range []string{"a1", "a2", "b1"} {
+		require.NoError(t, p.Store(ctx, name, []byte(name)))
+	}
+	require.NoError(t, other.Store(ctx, "a3", []byte("elsewhere")))
+	list := func(prefix string) []string {
+		var names []string
+		require.NoError(t, p.List(ctx, prefix, func(name string, modified time.Time) error {
+			require.False(t, modified.IsZero())
+			names = append(names, name)
+			return nil
+		}))
+		return names
+	}
+	require.Equal(t, []string{"a1", "a2", "b1"}, list(""))
+	require.Equal(t, []string{"a1", "a2"}, list("a"))
+
+	exists, err := p.Exists(ctx, "a1")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.NoError(t, p.Delete(ctx, "a1"))
+	require.Equal(t, []string{"a2", "b1"}, list(""))
+	exists, err = p.Exists(ctx, "a1")
+	require.NoError(t, err)
+	require.False(t, exists)
+	_, err = p.Load(ctx, "a1")
+	require.True(t, mast.IsNotFound(err), "%v", err)
+}
+
+func TestRootStore(t *testing.T) {
+	t.Parallel()
+	c, bucketName, closer := s3test.Client()
+	t.Cleanup(closer)
+	persisttest.RootStore(t, s3Persist.NewRootStore(s3test.NewConditionalClient(c), bucketName, "root/"))
+}
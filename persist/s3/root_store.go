@@ -0,0 +1,108 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jrhy/mast"
+)
+
+// RootStore implements the mast.RootStore interface, keeping each named root as a JSON
+// object. CompareAndSwap relies on S3 conditional writes (If-Match and If-None-Match).
+type RootStore struct {
+	s3         S3Interface
+	BucketName string
+	Prefix     string
+}
+
+var _ mast.RootStore = RootStore{}
+
+// NewRootStore returns a RootStore that keeps roots as objects with the given S3 client,
+// bucket name and key prefix.
+func NewRootStore(client S3Interface, bucketName, prefix string) RootStore {
+	return RootStore{
+		s3:         client,
+		BucketName: bucketName,
+		Prefix:     prefix,
+	}
+}
+
+// Get returns the root in the named object, or nil if there isn't one.
+func (rs RootStore) Get(ctx context.Context, name string) (*mast.Root, error) {
+	root, _, err := rs.get(ctx, name)
+	return root, err
+}
+
+// get returns the named root and the ETag of the object it was in.
+func (rs RootStore) get(ctx context.Context, name string) (*mast.Root, *string, error) {
+	input := s3.GetObjectInput{
+		Bucket: &rs.BucketName,
+		Key:    aws.String(rs.Prefix + name),
+	}
+	output, err := rs.s3.GetObjectWithContext(ctx, &input)
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	defer output.Body.Close()
+	b, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var root mast.Root
+	err = json.Unmarshal(b, &root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unmarshal %s: %w", name, err)
+	}
+	return &root, output.ETag, nil
+}
+
+// CompareAndSwap replaces the named object with new, if it currently has old, or returns
+// mast.ErrRootConflict.
+func (rs RootStore) CompareAndSwap(ctx context.Context, name string, old, new *mast.Root) error {
+	if new == nil {
+		return errors.New("cannot swap in a nil root")
+	}
+	b, err := json.Marshal(new)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	current, etag, err := rs.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !current.Equal(old) {
+		return mast.ErrRootConflict
+	}
+	condition := map[string]string{"If-None-Match": "*"}
+	if current != nil {
+		condition = map[string]string{"If-Match": aws.StringValue(etag)}
+	}
+	input := s3.PutObjectInput{
+		Bucket: &rs.BucketName,
+		Key:    aws.String(rs.Prefix + name),
+		Body:   bytes.NewReader(b),
+	}
+	_, err = rs.s3.PutObjectWithContext(ctx, &input, request.WithSetRequestHeaders(condition))
+	if err != nil {
+		var rerr awserr.RequestFailure
+		if errors.As(err, &rerr) &&
+			(rerr.StatusCode() == http.StatusPreconditionFailed || rerr.StatusCode() == http.StatusConflict) {
+			return mast.ErrRootConflict
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package s3test
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ConditionalClient wraps an S3 client to enforce the If-Match and If-None-Match headers
+// of PutObject requests, which the fake S3 server ignores.
+type ConditionalClient struct {
+	*s3.S3
+	l sync.Mutex
+}
+
+// NewConditionalClient returns a ConditionalClient for the given client. Conditions are
+// only enforced between requests made through the same ConditionalClient.
+func NewConditionalClient(client *s3.S3) *ConditionalClient {
+	return &ConditionalClient{S3: client}
+}
+
+// PutObjectWithContext puts the object if the conditions set in the request headers hold,
+// or fails with 412 Precondition Failed.
+func (c *ConditionalClient) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	req := request.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+	req.ApplyOptions(opts...)
+	ifMatch := req.HTTPRequest.Header.Get("If-Match")
+	ifNoneMatch := req.HTTPRequest.Header.Get("If-None-Match")
+
+	c.l.Lock()
+	defer c.l.Unlock()
+	if ifMatch != "" || ifNoneMatch != "" {
+		var etag string
+		head, err := c.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: input.Bucket,
+			Key:    input.Key,
+		})
+		if err == nil {
+			etag = aws.StringValue(head.ETag)
+		} else if aerr, ok := err.(awserr.RequestFailure); !ok || aerr.StatusCode() != http.StatusNotFound {
+			return nil, err
+		}
+		if ifNoneMatch == "*" && etag != "" || ifMatch != "" && ifMatch != etag {
+			return nil, awserr.NewRequestFailure(
+				awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil),
+				http.StatusPreconditionFailed, "")
+		}
+	}
+	return c.S3.PutObjectWithContext(ctx, input, opts...)
+}
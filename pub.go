@@ -4,9 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"reflect"
 	"sort"
-	"sync"
+	"time"
 )
 
 var (
@@ -18,7 +19,8 @@ var (
 type CreateRemoteOptions struct {
 	// BranchFactor, or number of entries per node.  0 means use DefaultBranchFactor.
 	BranchFactor uint
-	// NodeFormat, defaults to more-compact "v1.1.5binary" for new trees, can be set to "v1marshaler" to make nodes compatible with pre-v1.1.5 code.
+	// NodeFormat, defaults to more-compact "v1.1.5binary" for new trees, can be set to "v1marshaler" to make nodes compatible with pre-v1.1.5 code,
+	// or to "v1.1.5binary+counts" to also persist subtree sizes for fast Rank, Select and CountRange.
 	NodeFormat nodeFormat
 }
 type nodeFormat string
@@ -26,6 +28,9 @@ type nodeFormat string
 var (
 	V1Marshaler = nodeFormat("v1marshaler")
 	V115Binary  = nodeFormat("v1.1.5binary")
+	// V115BinaryCounted is V115Binary plus the number of entries under each link, which lets
+	// Rank, Select, CountRange and Cursor.Seek skip over subtrees without loading them.
+	V115BinaryCounted = nodeFormat("v1.1.5binary+counts")
 )
 
 // entry represents a key and value in the tree.
@@ -48,6 +53,39 @@ type Persist interface {
 	NodeURLPrefix() string
 }
 
+// ErrNotFound is wrapped by the errors Persists return from Load for names that aren't
+// stored, so that they can be told apart from failures to load.
+var ErrNotFound = errors.New("not found")
+
+// IsNotFound indicates that the given error from a Persist's Load means there is nothing
+// stored by that name, rather than that loading failed. Errors wrapping fs.ErrNotExist,
+// like those from loading missing files, count too.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, fs.ErrNotExist)
+}
+
+// Lister is implemented by Persists that can enumerate what they have stored, such as
+// NewInMemoryStore and those in persist/file and persist/s3.
+type Lister interface {
+	// List invokes the given callback with the name and last-modified time of every stored
+	// item whose name starts with the given prefix, stopping at the first error.
+	List(ctx context.Context, prefix string, fn func(name string, modified time.Time) error) error
+}
+
+// Exister is implemented by Persists that can tell whether they have stored something
+// without loading it, such as NewInMemoryStore and those in persist/file and persist/s3.
+type Exister interface {
+	// Exists indicates there is an item with the given name.
+	Exists(ctx context.Context, name string) (bool, error)
+}
+
+// Deleter is implemented by Persists that can remove what they have stored, such as
+// NewInMemoryStore and those in persist/file and persist/s3.
+type Deleter interface {
+	// Delete removes the item with the given name. Deleting an absent item is not an error.
+	Delete(ctx context.Context, name string) error
+}
+
 // RemoteConfig controls how nodes are persisted and loaded.
 type RemoteConfig struct {
 	// KeysLike is an instance of the type keys will be deserialized as.
@@ -74,6 +112,31 @@ type RemoteConfig struct {
 	NodeCache NodeCache
 
 	KeyCompare func(_, _ interface{}) (int, error)
+
+	// DirtyNodeBudget limits how many changed nodes the tree keeps in memory before
+	// writing some of them to StoreImmutablePartsWith, ahead of MakeRoot, so that large
+	// changes can be made with bounded memory. Nodes written early that are changed again
+	// are left for CollectGarbage. 0 means no limit; negative values are an error.
+	//
+	// The budget is checked after each change, and the subtrees under the root are then
+	// written whole, so it bounds memory between changes rather than during them: a single
+	// Batch or DeleteRange, or a change to a tree whose root has many dirty descendants,
+	// can exceed it until the check. If writing fails, the change that triggered it stays
+	// applied in memory, and its error is returned; MakeRoot will try again to store the
+	// nodes.
+	DirtyNodeBudget int
+
+	// FlushOptions controls how nodes are stored. nil means use the defaults.
+	FlushOptions *FlushOptions
+
+	// ReadAhead is how many nodes iterators and diffs may load at once in the background,
+	// ahead of when they're needed, so that scans of a remote Persist aren't limited by
+	// its latency. 0 means nodes are loaded only when needed.
+	ReadAhead int
+
+	// VerifyNodes makes loading a node check that its bytes hash to its name, returning
+	// ErrCorruptNode if not, to detect a Persist returning corrupted or wrong data.
+	VerifyNodes bool
 }
 
 // Root identifies a version of a tree whose nodes are accessible in the persistent store.
@@ -85,17 +148,58 @@ type Root struct {
 	NodeFormat   string `json:"NodeFormat,omitempty"`
 }
 
-// Delete deletes the entry with given key and value from the tree.
+// Delete deletes the entry with given key and value from the tree. If storing nodes to
+// keep within RemoteConfig.DirtyNodeBudget fails, the entry is still deleted.
 func (m *Mast) Delete(ctx context.Context, key, value interface{}) error {
+	existed, _, err := m.deleteIf(ctx, key, func(found interface{}) (bool, error) {
+		if found != value {
+			return false, fmt.Errorf("value not present for given key (found=%v, wanted=%v)", found, value)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !existed {
+		return fmt.Errorf("key %v not present in tree", key)
+	}
+	return nil
+}
+
+// DeleteKey deletes the entry with the given key, whatever its value, returning whether
+// there was one, and its value.
+func (m *Mast) DeleteKey(ctx context.Context, key interface{}) (bool, interface{}, error) {
+	return m.deleteIf(ctx, key, func(interface{}) (bool, error) { return true, nil })
+}
+
+// DeleteIf deletes the entry with the given key if the given predicate is true for its
+// value, returning whether it was deleted.
+func (m *Mast) DeleteIf(ctx context.Context, key interface{}, pred func(value interface{}) bool) (bool, error) {
+	var deleted bool
+	_, _, err := m.deleteIf(ctx, key, func(value interface{}) (bool, error) {
+		deleted = pred(value)
+		return deleted, nil
+	})
+	return deleted && err == nil, err
+}
+
+// deleteIf deletes the entry with the given key if the given function allows it, returning
+// whether the entry existed and its value. The entry is not deleted if the function
+// returns false or an error.
+func (m *Mast) deleteIf(
+	ctx context.Context,
+	key interface{},
+	allow func(value interface{}) (bool, error),
+) (bool, interface{}, error) {
 	if m.debug {
 		fmt.Printf("deleting %v...\n", key)
 	}
 	if m.root == nil {
-		return fmt.Errorf("key %v not present in tree", key)
+		return false, nil, nil
 	}
 	keyLayer, err := m.keyLayer(key, m.branchFactor)
 	if err != nil {
-		return fmt.Errorf("layer: %w", err)
+		return false, nil, fmt.Errorf("layer: %w", err)
 	}
 	options := findOptions{
 		targetLayer:        uint8min(keyLayer, m.height),
@@ -103,30 +207,44 @@ func (m *Mast) Delete(ctx context.Context, key, value interface{}) error {
 		createMissingNodes: false,
 		path:               []pathEntry{},
 	}
-	node, i, err := findEntry(ctx, m, key, value, &options)
+	node, i, err := findEntry(ctx, m, key, &options)
 	if err != nil {
-		return err
+		return false, nil, err
+	}
+	if node == nil {
+		return false, nil, nil
+	}
+	oldValue := node.Value[i]
+	ok, err := allow(oldValue)
+	if err != nil || !ok {
+		return true, oldValue, err
 	}
 	node, err = deleteEntry(ctx, m, node, i)
 	if err != nil {
-		return err
+		return true, oldValue, err
 	}
 	options.path[len(options.path)-1].node = node
 	err = m.savePathForRoot(ctx, options.path)
 	if err != nil {
-		return fmt.Errorf("savePathForRoot: %w", err)
+		return true, oldValue, fmt.Errorf("savePathForRoot: %w", err)
 	}
 	m.size--
 	for m.size < m.shrinkBelowSize && m.height > 0 {
 		err = m.shrink(ctx)
 		if err != nil {
-			return fmt.Errorf("shrink: %w", err)
+			return true, oldValue, fmt.Errorf("shrink: %w", err)
 		}
 	}
-	return nil
+	err = m.noteDirty(ctx, 1)
+	if err != nil {
+		return true, oldValue, err
+	}
+	return true, oldValue, nil
 }
 
-func findEntry(ctx context.Context, m *Mast, key, value interface{}, options *findOptions) (*mastNode, int, error) {
+// findEntry returns the node and index of the entry with the given key, or a nil node if
+// the tree doesn't contain it.
+func findEntry(ctx context.Context, m *Mast, key interface{}, options *findOptions) (*mastNode, int, error) {
 	node, err := m.load(ctx, m.root)
 	if err != nil {
 		return nil, 0, fmt.Errorf("load root: %w", err)
@@ -137,17 +255,14 @@ func findEntry(ctx context.Context, m *Mast, key, value interface{}, options *fi
 	}
 	if options.targetLayer != options.currentHeight ||
 		i == len(node.Key) {
-		return nil, 0, fmt.Errorf("key %v not present in tree", key)
+		return nil, 0, nil
 	}
 	cmp, err := m.keyOrder(node.Key[i], key)
 	if err != nil {
 		return nil, 0, fmt.Errorf("keyCompare: %w", err)
 	}
 	if cmp != 0 {
-		return nil, 0, fmt.Errorf("key %v not present in tree", key)
-	}
-	if node.Value[i] != value {
-		return nil, 0, fmt.Errorf("value not present for given key (found=%v, wanted=%v)", node.Value[i], value)
+		return nil, 0, nil
 	}
 	return node, i, nil
 }
@@ -183,6 +298,24 @@ func (m *Mast) StartDiff(
 	}, nil
 }
 
+// StartDiffRange is like StartDiff, but only reports differences for keys from lo (inclusive)
+// up to hi (exclusive). A nil lo or hi leaves that end of the range unbounded. Subtrees
+// entirely outside the range are not visited.
+func (m *Mast) StartDiffRange(
+	ctx context.Context,
+	oldMast *Mast,
+	lo, hi interface{},
+) (*DiffCursor, error) {
+	ds := newDiffState(oldMast, m)
+	bounds := &keyRange{lo: lo, hi: hi, loInclusive: true}
+	ds.oldStack.bounds = bounds
+	ds.newStack.bounds = bounds
+	return &DiffCursor{
+		m:         m,
+		diffState: ds,
+	}, nil
+}
+
 type Diff struct {
 	Key      interface{}
 	Type     DiffType
@@ -260,6 +393,12 @@ func (m *Mast) DiffLinks(
 
 // flush serializes changes (new nodes) into the persistent store.
 func (m *Mast) flush(ctx context.Context) (string, error) {
+	return m.flushWithOptions(ctx, nil)
+}
+
+// flushWithOptions is flush, storing nodes according to the given options, or the tree's
+// if nil.
+func (m *Mast) flushWithOptions(ctx context.Context, options *FlushOptions) (string, error) {
 	if m.persist == nil {
 		return "", fmt.Errorf("no persistence mechanism set; set RemoteConfig.StoreImmutablePartsWith")
 	}
@@ -270,77 +409,19 @@ func (m *Mast) flush(ctx context.Context) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("load root: %w", err)
 	}
-	storeQ := make(chan func() error)
-	n := 40
-	gate := make(chan interface{}, n)
-	for i := 0; i < n; i++ {
-		gate <- nil
-	}
-	seLock := sync.Mutex{}
-	var firstStoreError error
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		for {
-			f := <-storeQ
-			<-gate
-			if f == nil {
-				break
-			}
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				defer func() { gate <- nil }()
-				seLock.Lock()
-				if firstStoreError != nil {
-					seLock.Unlock()
-					return
-				}
-				seLock.Unlock()
-				cberr := f()
-				if cberr != nil {
-					seLock.Lock()
-					if firstStoreError == nil {
-						firstStoreError = cberr
-					}
-					seLock.Unlock()
-				}
-			}()
-		}
-		wg.Done()
-	}()
-
-	if !m.unmarshalerUsesRegisteredTypes && (m.zeroKey == nil || m.zeroValue == nil) {
-		return "", errors.New("will not be able to figure out which type to unmarshal entries as; set RemoteConfig.{Keys,Values}Like or UnmarshalerUsesRegisteredTypes")
-	}
-
-	versionedMarshaler := func(i interface{}) ([]byte, error) {
-		switch m.nodeFormat {
-		case V1Marshaler:
-			switch x := i.(type) {
-			case mastNode:
-				return m.marshal(x.Node)
-			default:
-				return m.marshal(x)
-			}
-		case V115Binary:
-			node, ok := i.(mastNode)
-			if !ok {
-				return nil, fmt.Errorf("expected mast.mastNode, got %T", i)
-			}
-			return marshalMastNode(&node, m.marshal)
-		}
-		return nil, fmt.Errorf("unknown node format '%v'", m.nodeFormat)
+	err = m.checkEntryTypes()
+	if err != nil {
+		return "", err
 	}
-
-	str, err := node.store(ctx, m.persist, m.nodeCache, versionedMarshaler, storeQ)
-	close(storeQ)
-	wg.Wait()
+	q := m.newStoreQueue(options)
+	q.resume(ctx)
+	str, err := node.store(ctx, m.nodeCache, m.nodeMarshaler(), m.nodeSizer(), q)
+	storeErr := q.wait()
 	if err != nil {
 		return "", err
 	}
-	if firstStoreError != nil {
-		return "", firstStoreError
+	if storeErr != nil {
+		return "", storeErr
 	}
 	m.root = str
 	return str, nil
@@ -388,7 +469,8 @@ func (m *Mast) Get(ctx context.Context, k, value interface{}) (bool, error) {
 	return true, nil
 }
 
-// Insert adds or replaces the value for the given key.
+// Insert adds or replaces the value for the given key. If storing nodes to keep within
+// RemoteConfig.DirtyNodeBudget fails, the entry is still inserted.
 func (m *Mast) Insert(ctx context.Context, key, value interface{}) error {
 	if m.debug {
 		fmt.Printf("inserting %v...\n", key)
@@ -434,7 +516,11 @@ func (m *Mast) Insert(ctx context.Context, key, value interface{}) error {
 			node.Dirty()
 			node.Value[i] = value
 			options.path[len(options.path)-1].node = node
-			return m.savePathForRoot(ctx, options.path)
+			err = m.savePathForRoot(ctx, options.path)
+			if err != nil {
+				return err
+			}
+			return m.noteDirty(ctx, 1)
 		}
 	}
 	// XXX do after split, XXX mark tree invalid if split fails
@@ -502,11 +588,58 @@ func (m *Mast) Insert(ctx context.Context, key, value interface{}) error {
 		}
 	}
 	m.size++
-	return nil
+	return m.noteDirty(ctx, 1)
+}
+
+// InsertIfAbsent adds the given entry if the tree doesn't already have the key, returning
+// whether it was added.
+func (m *Mast) InsertIfAbsent(ctx context.Context, key, value interface{}) (bool, error) {
+	found, err := m.Get(ctx, key, nil)
+	if err != nil || found {
+		return false, err
+	}
+	err = m.Insert(ctx, key, value)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Replace sets the value for the given key only if the tree already has the key, returning
+// whether it did, and the previous value.
+func (m *Mast) Replace(ctx context.Context, key, value interface{}) (bool, interface{}, error) {
+	var old interface{}
+	found, err := m.Get(ctx, key, &old)
+	if err != nil || !found {
+		return false, nil, err
+	}
+	err = m.Insert(ctx, key, value)
+	if err != nil {
+		return true, old, err
+	}
+	return true, old, nil
+}
+
+// CompareAndSet sets the value for the given key only if the tree has the key with a value
+// equal to old, returning whether it did.
+func (m *Mast) CompareAndSet(ctx context.Context, key, old, new interface{}) (bool, error) {
+	var current interface{}
+	found, err := m.Get(ctx, key, &current)
+	if err != nil || !found || !reflect.DeepEqual(current, old) {
+		return false, err
+	}
+	err = m.Insert(ctx, key, new)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // Iter iterates over the entries of a tree, invoking the given callback for every entry's key and value.
 func (m *Mast) Iter(ctx context.Context, f func(interface{}, interface{}) error) error {
+	if m.root == nil {
+		return nil
+	}
 	node, err := m.load(ctx, m.root)
 	if err != nil {
 		return err
@@ -559,6 +692,19 @@ func (m *Mast) SeekIter(ctx context.Context, k interface{}, f func(interface{},
 // LoadMast loads a tree from a remote store. The root is loaded
 // and verified; other nodes will be loaded on demand.
 func (r *Root) LoadMast(ctx context.Context, config *RemoteConfig) (*Mast, error) {
+	m, err := r.newMast(config)
+	if err != nil {
+		return nil, err
+	}
+	err = m.checkRoot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("checkRoot: %w", err)
+	}
+	return m, nil
+}
+
+// newMast makes a tree for the root without loading anything.
+func (r *Root) newMast(config *RemoteConfig) (*Mast, error) {
 	var link interface{}
 	if r.Link != nil {
 		link = *r.Link
@@ -573,11 +719,16 @@ func (r *Root) LoadMast(ctx context.Context, config *RemoteConfig) (*Mast, error
 	switch r.NodeFormat {
 	case string(V115Binary):
 		nf = V115Binary
+	case string(V115BinaryCounted):
+		nf = V115BinaryCounted
 	case "", string(V1Marshaler):
 		nf = V1Marshaler
 	default:
 		return nil, fmt.Errorf("unknown node format: %s", r.NodeFormat)
 	}
+	if config.DirtyNodeBudget < 0 {
+		return nil, fmt.Errorf("negative DirtyNodeBudget %d", config.DirtyNodeBudget)
+	}
 
 	m := Mast{
 		root:                           link,
@@ -595,6 +746,9 @@ func (r *Root) LoadMast(ctx context.Context, config *RemoteConfig) (*Mast, error
 		growAfterSize:                  shrinkSize * uint64(r.BranchFactor),
 		nodeCache:                      config.NodeCache,
 		nodeFormat:                     nf,
+		dirtyNodeBudget:                uint64(config.DirtyNodeBudget),
+		flushOptions:                   config.FlushOptions,
+		verifyNodes:                    config.VerifyNodes,
 	}
 	if config.Unmarshal == nil {
 		m.unmarshal = defaultUnmarshal
@@ -606,9 +760,8 @@ func (r *Root) LoadMast(ctx context.Context, config *RemoteConfig) (*Mast, error
 		m.keyOrder = DefaultKeyCompare(m.marshal)
 	}
 	m.keyLayer = DefaultLayer(m.marshal)
-	err := m.checkRoot(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("checkRoot: %w", err)
+	if config.ReadAhead > 0 {
+		m.prefetcher = newPrefetcher(config.ReadAhead, m.nodeCache)
 	}
 	return &m, nil
 }
@@ -616,7 +769,14 @@ func (r *Root) LoadMast(ctx context.Context, config *RemoteConfig) (*Mast, error
 // MakeRoot makes a new persistent root, after ensuring all the changed nodes
 // have been written to the persistent store.
 func (m *Mast) MakeRoot(ctx context.Context) (*Root, error) {
-	link, err := m.flush(ctx)
+	return m.MakeRootWithOptions(ctx, nil)
+}
+
+// MakeRootWithOptions is MakeRoot, storing nodes according to the given options instead of
+// RemoteConfig.FlushOptions. If storing fails, the nodes that weren't stored are kept, so
+// MakeRoot can be tried again without serializing them again.
+func (m *Mast) MakeRootWithOptions(ctx context.Context, options *FlushOptions) (*Root, error) {
+	link, err := m.flushWithOptions(ctx, options)
 	if err != nil {
 		return nil, fmt.Errorf("flush: %w", err)
 	}
@@ -683,6 +843,12 @@ func (m *Mast) Size() uint64 {
 // but can evolve independently (copy-on-write).
 func (m *Mast) Clone(ctx context.Context) (Mast, error) {
 	m2 := *m
+	if m.pendingStores != nil {
+		m2.pendingStores = make(map[string][]byte, len(m.pendingStores))
+		for name, encoded := range m.pendingStores {
+			m2.pendingStores[name] = encoded
+		}
+	}
 	if m.root != nil {
 		newNode, err := m.load(ctx, m.root)
 		if err != nil {
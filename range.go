@@ -0,0 +1,458 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+)
+
+// keyRange bounds keys by optional lower and upper limits; a nil limit is unbounded.
+type keyRange struct {
+	lo, hi                   interface{}
+	loInclusive, hiInclusive bool
+}
+
+// below indicates the given key is less than the range's lower limit.
+func (r *keyRange) below(m *Mast, key interface{}) (bool, error) {
+	if r.lo == nil {
+		return false, nil
+	}
+	cmp, err := m.keyOrder(key, r.lo)
+	if err != nil {
+		return false, fmt.Errorf("keyCompare: %w", err)
+	}
+	return cmp < 0 || cmp == 0 && !r.loInclusive, nil
+}
+
+// above indicates the given key is greater than the range's upper limit.
+func (r *keyRange) above(m *Mast, key interface{}) (bool, error) {
+	if r.hi == nil {
+		return false, nil
+	}
+	cmp, err := m.keyOrder(key, r.hi)
+	if err != nil {
+		return false, fmt.Errorf("keyCompare: %w", err)
+	}
+	return cmp > 0 || cmp == 0 && !r.hiInclusive, nil
+}
+
+// linkBelow indicates that the whole subtree at node.Link[i] is below the range.
+func (r *keyRange) linkBelow(m *Mast, node *mastNode, i int) (bool, error) {
+	if r.lo == nil || i >= len(node.Key) {
+		return false, nil
+	}
+	cmp, err := m.keyOrder(node.Key[i], r.lo)
+	if err != nil {
+		return false, fmt.Errorf("keyCompare: %w", err)
+	}
+	return cmp <= 0, nil
+}
+
+// linkAbove indicates that the whole subtree at node.Link[i] is above the range.
+func (r *keyRange) linkAbove(m *Mast, node *mastNode, i int) (bool, error) {
+	if r.hi == nil || i == 0 {
+		return false, nil
+	}
+	cmp, err := m.keyOrder(node.Key[i-1], r.hi)
+	if err != nil {
+		return false, fmt.Errorf("keyCompare: %w", err)
+	}
+	return cmp >= 0, nil
+}
+
+// IterRange iterates over the entries with keys between lo and hi, in ascending order,
+// invoking the given callback for every entry's key and value. A nil lo or hi leaves
+// that end of the range unbounded. Subtrees entirely outside the range are not loaded.
+func (m *Mast) IterRange(
+	ctx context.Context,
+	lo, hi interface{},
+	loInclusive, hiInclusive bool,
+	f func(interface{}, interface{}) error,
+) error {
+	if m.root == nil {
+		return nil
+	}
+	node, err := m.load(ctx, m.root)
+	if err != nil {
+		return err
+	}
+	r := keyRange{lo, hi, loInclusive, hiInclusive}
+	err = node.iterRange(ctx, &r, f, m)
+	if err == nil || err == ErrIterDone {
+		return nil
+	}
+	return err
+}
+
+// IterRangeReverse is like IterRange, but visits the entries in descending order.
+func (m *Mast) IterRangeReverse(
+	ctx context.Context,
+	lo, hi interface{},
+	loInclusive, hiInclusive bool,
+	f func(interface{}, interface{}) error,
+) error {
+	if m.root == nil {
+		return nil
+	}
+	node, err := m.load(ctx, m.root)
+	if err != nil {
+		return err
+	}
+	r := keyRange{lo, hi, loInclusive, hiInclusive}
+	err = node.iterRangeReverse(ctx, &r, f, m)
+	if err == nil || err == ErrIterDone {
+		return nil
+	}
+	return err
+}
+
+func (node *mastNode) iterRange(ctx context.Context, r *keyRange, f func(interface{}, interface{}) error, m *Mast) error {
+	node.prefetchRange(ctx, r, m)
+	for i, link := range node.Link {
+		above, err := r.linkAbove(m, node, i)
+		if err != nil {
+			return err
+		}
+		if above {
+			return nil
+		}
+		below, err := r.linkBelow(m, node, i)
+		if err != nil {
+			return err
+		}
+		if link != nil && !below {
+			child, err := m.load(ctx, link)
+			if err != nil {
+				return err
+			}
+			err = child.iterRange(ctx, r, f, m)
+			if err != nil {
+				return err
+			}
+		}
+		if i == len(node.Key) {
+			break
+		}
+		above, err = r.above(m, node.Key[i])
+		if err != nil {
+			return err
+		}
+		if above {
+			return nil
+		}
+		below, err = r.below(m, node.Key[i])
+		if err != nil {
+			return err
+		}
+		if !below {
+			err = f(node.Key[i], node.Value[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (node *mastNode) iterRangeReverse(ctx context.Context, r *keyRange, f func(interface{}, interface{}) error, m *Mast) error {
+	node.prefetchRange(ctx, r, m)
+	for i := len(node.Link) - 1; i >= 0; i-- {
+		below, err := r.linkBelow(m, node, i)
+		if err != nil {
+			return err
+		}
+		if below {
+			return nil
+		}
+		above, err := r.linkAbove(m, node, i)
+		if err != nil {
+			return err
+		}
+		if node.Link[i] != nil && !above {
+			child, err := m.load(ctx, node.Link[i])
+			if err != nil {
+				return err
+			}
+			err = child.iterRangeReverse(ctx, r, f, m)
+			if err != nil {
+				return err
+			}
+		}
+		if i == 0 {
+			break
+		}
+		below, err = r.below(m, node.Key[i-1])
+		if err != nil {
+			return err
+		}
+		if below {
+			return nil
+		}
+		above, err = r.above(m, node.Key[i-1])
+		if err != nil {
+			return err
+		}
+		if !above {
+			err = f(node.Key[i-1], node.Value[i-1])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prefetchRange prefetches the node's links that may have entries in the range.
+func (node *mastNode) prefetchRange(ctx context.Context, r *keyRange, m *Mast) {
+	if m.prefetcher == nil {
+		return
+	}
+	var links []interface{}
+	for i, link := range node.Link {
+		below, err := r.linkBelow(m, node, i)
+		if err != nil {
+			return
+		}
+		above, err := r.linkAbove(m, node, i)
+		if err != nil {
+			return
+		}
+		if !below && !above {
+			links = append(links, link)
+		}
+	}
+	m.prefetch(ctx, links)
+}
+
+// rangeBoundaries is the number of paths DeleteRange dirties, to the nodes at either end of
+// the range; the nodes in between are dropped rather than changed.
+const rangeBoundaries = 2
+
+// DeleteRange deletes the entries with keys from lo (inclusive) up to hi (exclusive),
+// returning how many were deleted. A nil lo or hi leaves that end of the range unbounded.
+// Subtrees that are entirely in the range are dropped without being rewritten. With the
+// V115BinaryCounted node format, they aren't loaded either. Otherwise, the number of
+// entries deleted is found by counting either the dropped subtrees or what remains of the
+// tree, whichever is smaller. If storing nodes to keep within
+// RemoteConfig.DirtyNodeBudget fails, the entries are still deleted.
+func (m *Mast) DeleteRange(ctx context.Context, lo, hi interface{}) (uint64, error) {
+	if m.root == nil {
+		return 0, nil
+	}
+	r := keyRange{lo, hi, true, false}
+	var dropped []interface{}
+	newRoot, removed, err := m.deleteRange(ctx, m.root, &r, &dropped)
+	if err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	n, err := m.droppedSize(ctx, newRoot, removed, dropped)
+	if err != nil {
+		return 0, fmt.Errorf("size: %w", err)
+	}
+	removed += n
+	m.root = newRoot
+	m.size -= removed
+	if m.size == 0 {
+		m.height = 0
+		m.shrinkBelowSize = 1
+		m.growAfterSize = uint64(m.branchFactor)
+		return removed, nil
+	}
+	for m.size < m.shrinkBelowSize && m.height > 0 {
+		err = m.shrink(ctx)
+		if err != nil {
+			return removed, fmt.Errorf("shrink: %w", err)
+		}
+	}
+	return removed, m.noteDirty(ctx, rangeBoundaries)
+}
+
+// droppedSize returns the number of entries in the given dropped subtrees, whose sizes
+// aren't persisted. Rather than loading all of them, which for a large range could be most
+// of the tree, it counts them and what remains in the tree at the given new root a node at a
+// time each, until one is done. If the remaining entries are counted first, they are
+// subtracted from those before the deletion, less the given number already counted as
+// removed. Either way, the nodes loaded are about twice the smaller count.
+func (m *Mast) droppedSize(ctx context.Context, newRoot interface{}, removed uint64, dropped []interface{}) (uint64, error) {
+	if len(dropped) == 0 {
+		return 0, nil
+	}
+	droppedCount := sizeCounter{todo: dropped}
+	remainingCount := sizeCounter{todo: []interface{}{newRoot}}
+	for {
+		done, err := droppedCount.step(ctx, m)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			return droppedCount.size, nil
+		}
+		done, err = remainingCount.step(ctx, m)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			return m.size - removed - remainingCount.size, nil
+		}
+	}
+}
+
+// sizeCounter counts the entries under some links, a node at a time.
+type sizeCounter struct {
+	// todo has the links yet to be counted.
+	todo []interface{}
+	size uint64
+}
+
+// step counts the entries in the next node, returning whether all have been counted.
+func (c *sizeCounter) step(ctx context.Context, m *Mast) (bool, error) {
+	for len(c.todo) > 0 {
+		link := c.todo[len(c.todo)-1]
+		c.todo = c.todo[:len(c.todo)-1]
+		if link == nil {
+			continue
+		}
+		node, err := m.load(ctx, link)
+		if err != nil {
+			return false, err
+		}
+		c.size += uint64(len(node.Key))
+		for i, child := range node.Link {
+			if !node.dirty && node.linkCount != nil {
+				c.size += node.linkCount[i]
+			} else if child != nil {
+				c.todo = append(c.todo, child)
+			}
+		}
+		break
+	}
+	return len(c.todo) == 0, nil
+}
+
+// deleteRange removes the entries in the given range from the subtree of the given height
+// at the given link, returning the subtree's new link and the number of entries removed.
+// Dropped subtrees whose sizes aren't persisted are not counted, but added to the given
+// slice.
+func (m *Mast) deleteRange(
+	ctx context.Context,
+	link interface{},
+	r *keyRange,
+	dropped *[]interface{},
+) (interface{}, uint64, error) {
+	node, err := m.load(ctx, link)
+	if err != nil {
+		return nil, 0, fmt.Errorf("load: %w", err)
+	}
+	// keys [start, end) are in the range
+	start := 0
+	for ; start < len(node.Key); start++ {
+		below, err := r.below(m, node.Key[start])
+		if err != nil {
+			return nil, 0, err
+		}
+		if !below {
+			break
+		}
+	}
+	end := start
+	for ; end < len(node.Key); end++ {
+		above, err := r.above(m, node.Key[end])
+		if err != nil {
+			return nil, 0, err
+		}
+		if above {
+			break
+		}
+	}
+	var removed uint64
+	var leftLink, rightLink interface{}
+	if node.Link[start] != nil {
+		var n uint64
+		leftLink, n, err = m.deleteRange(ctx, node.Link[start], r, dropped)
+		if err != nil {
+			return nil, 0, err
+		}
+		removed += n
+	}
+	if start == end {
+		if removed == 0 {
+			return link, 0, nil
+		}
+		node = node.ToMut(ctx, m)
+		node.Dirty()
+		node.Link[start] = leftLink
+		if node.isEmpty() {
+			return nil, removed, nil
+		}
+		return node, removed, nil
+	}
+	if node.Link[end] != nil {
+		var n uint64
+		rightLink, n, err = m.deleteRange(ctx, node.Link[end], r, dropped)
+		if err != nil {
+			return nil, 0, err
+		}
+		removed += n
+	}
+	for i := start + 1; i < end; i++ {
+		if node.Link[i] == nil {
+			continue
+		}
+		if !node.dirty && node.linkCount != nil {
+			removed += node.linkCount[i]
+			continue
+		}
+		*dropped = append(*dropped, node.Link[i])
+	}
+	removed += uint64(end - start)
+	mergedLink, err := m.mergeNodes(ctx, leftLink, rightLink)
+	if err != nil {
+		return nil, 0, fmt.Errorf("merge: %w", err)
+	}
+	node = node.ToMut(ctx, m)
+	node.Dirty()
+	node.Key = append(node.Key[:start], node.Key[end:]...)
+	node.Value = append(node.Value[:start], node.Value[end:]...)
+	node.Link = append(node.Link[:start+1], node.Link[end+1:]...)
+	node.Link[start] = mergedLink
+	if node.isEmpty() {
+		return nil, removed, nil
+	}
+	return node, removed, nil
+}
+
+// linkSize returns the number of entries in the subtree at the given link.
+func (m *Mast) linkSize(ctx context.Context, link interface{}) (uint64, error) {
+	if link == nil {
+		return 0, nil
+	}
+	node, err := m.load(ctx, link)
+	if err != nil {
+		return 0, err
+	}
+	return node.size(ctx, m)
+}
+
+// size returns the number of entries in the subtree rooted at the node.
+func (node *mastNode) size(ctx context.Context, m *Mast) (uint64, error) {
+	size := uint64(len(node.Key))
+	for i := range node.Link {
+		n, err := node.childSize(ctx, m, i)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// childSize returns the number of entries under node.Link[i], using the persisted counts
+// when the node has them, or counting the subtree otherwise.
+func (node *mastNode) childSize(ctx context.Context, m *Mast, i int) (uint64, error) {
+	if !node.dirty && node.linkCount != nil {
+		return node.linkCount[i], nil
+	}
+	return m.linkSize(ctx, node.Link[i])
+}
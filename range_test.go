@@ -0,0 +1,309 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/arbitrary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterRange(t *testing.T) {
+	t.Parallel()
+	m := NewInMemory()
+	for i := 0; i < 1000; i += 2 {
+		require.NoError(t, m.Insert(ctx, i, i*10))
+	}
+	collect := func(lo, hi interface{}, loInclusive, hiInclusive, reverse bool) []int {
+		var res []int
+		f := func(k, v interface{}) error {
+			require.Equal(t, k.(int)*10, v)
+			res = append(res, k.(int))
+			return nil
+		}
+		if reverse {
+			require.NoError(t, m.IterRangeReverse(ctx, lo, hi, loInclusive, hiInclusive, f))
+		} else {
+			require.NoError(t, m.IterRange(ctx, lo, hi, loInclusive, hiInclusive, f))
+		}
+		return res
+	}
+	require.Equal(t, []int{10, 12, 14}, collect(10, 14, true, true, false))
+	require.Equal(t, []int{12}, collect(10, 14, false, false, false))
+	require.Equal(t, []int{12, 14}, collect(11, 15, true, true, false))
+	require.Equal(t, []int{14, 12, 10}, collect(10, 14, true, true, true))
+	require.Equal(t, []int{12}, collect(10, 14, false, false, true))
+	require.Equal(t, []int{0, 2}, collect(nil, 4, true, false, false))
+	require.Equal(t, []int{998, 996}, collect(996, nil, true, true, true))
+	require.Len(t, collect(nil, nil, false, false, false), 500)
+	require.Empty(t, collect(14, 10, true, true, false))
+
+	var res []int
+	require.NoError(t, m.IterRange(ctx, 100, nil, true, false, func(k, v interface{}) error {
+		if len(res) == 3 {
+			return ErrIterDone
+		}
+		res = append(res, k.(int))
+		return nil
+	}))
+	require.Equal(t, []int{100, 102, 104}, res)
+}
+
+func TestIterRangeProperty(t *testing.T) {
+	t.Parallel()
+	properties := gopter.NewProperties(defaultGopterParameters)
+	arbitraries := arbitrary.DefaultArbitraries()
+	properties.Property("range iteration matches filtered keys",
+		arbitraries.ForAll(
+			func(keys []uint16, lo, hi uint, loInclusive, hiInclusive bool) bool {
+				m := newTestTree(uint(0), uint(0))
+				m.branchFactor = 4
+				m.growAfterSize = 4
+				expected := []uint{}
+				seen := map[uint]bool{}
+				for _, k16 := range keys {
+					k := uint(k16)
+					require.NoError(t, m.Insert(ctx, k, k))
+					if seen[k] {
+						continue
+					}
+					seen[k] = true
+					if (k > lo || loInclusive && k == lo) && (k < hi || hiInclusive && k == hi) {
+						expected = append(expected, k)
+					}
+				}
+				sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+				actual := []uint{}
+				require.NoError(t, m.IterRange(ctx, lo, hi, loInclusive, hiInclusive, func(k, _ interface{}) error {
+					actual = append(actual, k.(uint))
+					return nil
+				}))
+				reversed := []uint{}
+				require.NoError(t, m.IterRangeReverse(ctx, lo, hi, loInclusive, hiInclusive, func(k, _ interface{}) error {
+					reversed = append([]uint{k.(uint)}, reversed...)
+					return nil
+				}))
+				return assert.Equal(t, expected, actual) && assert.Equal(t, expected, reversed)
+			}))
+	properties.TestingRun(t)
+}
+
+func TestDeleteRangeProperty(t *testing.T) {
+	t.Parallel()
+	properties := gopter.NewProperties(defaultGopterParameters)
+	arbitraries := arbitrary.DefaultArbitraries()
+	properties.Property("range deletion matches deleting each key",
+		arbitraries.ForAll(
+			func(keys []uint16, lo, hi uint, flush bool) bool {
+				m := newTestTree(uint(0), "")
+				m.branchFactor = 4
+				m.growAfterSize = 4
+				for _, k := range keys {
+					require.NoError(t, m.Insert(ctx, uint(k), ""))
+				}
+				if flush {
+					_, err := m.flush(ctx)
+					require.NoError(t, err)
+				}
+				expected, err := m.Clone(ctx)
+				require.NoError(t, err)
+				expectedRemoved := uint64(0)
+				seen := map[uint]bool{}
+				for _, k16 := range keys {
+					k := uint(k16)
+					if seen[k] || k < lo || k >= hi {
+						continue
+					}
+					seen[k] = true
+					require.NoError(t, expected.Delete(ctx, k, ""))
+					expectedRemoved++
+				}
+				removed, err := m.DeleteRange(ctx, lo, hi)
+				require.NoError(t, err)
+				if !assert.Equal(t, expectedRemoved, removed) ||
+					!assert.Equal(t, expected.Size(), m.Size()) ||
+					!assert.Equal(t, expected.Height(), m.Height()) {
+					return false
+				}
+				if m.Size() == 0 {
+					return true
+				}
+				hash, err := m.flush(ctx)
+				require.NoError(t, err)
+				expectedHash, err := expected.flush(ctx)
+				require.NoError(t, err)
+				return assert.Equal(t, expectedHash, hash)
+			}))
+	properties.TestingRun(t)
+}
+
+func TestDeleteRangeUnbounded(t *testing.T) {
+	t.Parallel()
+	m := NewInMemory()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	removed, err := m.DeleteRange(ctx, nil, 100)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), removed)
+	removed, err = m.DeleteRange(ctx, 900, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), removed)
+	keys, err := m.keys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 800)
+	require.Equal(t, 100, keys[0])
+	require.Equal(t, 899, keys[len(keys)-1])
+	removed, err = m.DeleteRange(ctx, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(800), removed)
+	require.Equal(t, uint64(0), m.Size())
+	require.NoError(t, m.Insert(ctx, 5, 5))
+	keys, err = m.keys(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{5}, keys)
+}
+
+func TestDeleteRangeLoads(t *testing.T) {
+	t.Parallel()
+	for _, nf := range []nodeFormat{V115Binary, V115BinaryCounted} {
+		store := &countingStore{Persist: NewInMemoryStore()}
+		config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store}
+		m, err := NewRoot(&CreateRemoteOptions{NodeFormat: nf}).LoadMast(ctx, &config)
+		require.NoError(t, err)
+		for i := 0; i < 20_000; i++ {
+			require.NoError(t, m.Insert(ctx, i, i))
+		}
+		root, err := m.MakeRoot(ctx)
+		require.NoError(t, err)
+		report, err := Verify(ctx, root, &config)
+		require.NoError(t, err)
+
+		for _, tc := range []struct {
+			lo, hi   int
+			maxLoads int
+		}{
+			// about twice the nodes of the tenth that remains, not the whole tree
+			{10, 18_000, report.Nodes / 4},
+			{5_000, 5_100, 30},
+			{5, 19_995, 40},
+		} {
+			m, err = root.LoadMast(ctx, &config)
+			require.NoError(t, err)
+			store.loads = 0
+			removed, err := m.DeleteRange(ctx, tc.lo, tc.hi)
+			require.NoError(t, err)
+			require.Equal(t, uint64(tc.hi-tc.lo), removed)
+			require.LessOrEqual(t, store.loads, tc.maxLoads, "%s %d-%d", nf, tc.lo, tc.hi)
+			if nf == V115BinaryCounted {
+				require.Less(t, store.loads, 30)
+			}
+			require.Equal(t, uint64(20_000-tc.hi+tc.lo), m.Size())
+			deleted, err := m.MakeRoot(ctx)
+			require.NoError(t, err)
+			report, err := Verify(ctx, deleted, &config)
+			require.NoError(t, err)
+			require.True(t, report.OK(), "%v", report.Problems)
+		}
+	}
+}
+
+func TestStartDiffRangeProperty(t *testing.T) {
+	t.Parallel()
+	properties := gopter.NewProperties(defaultGopterParameters)
+	arbitraries := arbitrary.DefaultArbitraries()
+	properties.Property("range diff matches filtered diff",
+		arbitraries.ForAll(
+			func(oldOps, newOps []TestOperation, lo, hi uint) bool {
+				old := newTestTree(uint(0), uint(0))
+				require.NoError(t, old.apply(oldOps))
+				_, err := old.flush(ctx)
+				require.NoError(t, err)
+				new, err := old.Clone(ctx)
+				require.NoError(t, err)
+				require.NoError(t, new.apply(newOps))
+				expected := []Diff{}
+				require.NoError(t, new.DiffIter(ctx, &old, func(added, removed bool, key, addedValue, removedValue interface{}) (bool, error) {
+					if key.(uint) >= lo && key.(uint) < hi {
+						expected = append(expected, Diff{key, op(removed, added), removedValue, addedValue})
+					}
+					return true, nil
+				}))
+				dc, err := new.StartDiffRange(ctx, &old, lo, hi)
+				require.NoError(t, err)
+				actual := []Diff{}
+				for {
+					d, err := dc.NextEntry(ctx)
+					if err == ErrNoMoreDiffs {
+						break
+					}
+					require.NoError(t, err)
+					actual = append(actual, d)
+				}
+				return assert.Equal(t, expected, actual)
+			}))
+	properties.TestingRun(t)
+}
+
+type countingStore struct {
+	Persist
+	loads int
+}
+
+func (cs *countingStore) Load(ctx context.Context, name string) ([]byte, error) {
+	cs.loads++
+	return cs.Persist.Load(ctx, name)
+}
+
+func TestStartDiffRangeSkipsOtherSubtrees(t *testing.T) {
+	t.Parallel()
+	store := &countingStore{Persist: NewInMemoryStore()}
+	config := RemoteConfig{
+		KeysLike:                "",
+		ValuesLike:              0,
+		StoreImmutablePartsWith: store,
+	}
+	m, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for _, tenant := range []string{"a", "b", "c", "d"} {
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, m.Insert(ctx, fmt.Sprintf("%s/%04d", tenant, i), i))
+		}
+	}
+	oldRoot, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	for _, tenant := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, m.Insert(ctx, fmt.Sprintf("%s/%04d", tenant, 500), -1))
+	}
+	newRoot, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+
+	diffLoads := func(lo, hi interface{}) ([]interface{}, int) {
+		old, err := oldRoot.LoadMast(ctx, &config)
+		require.NoError(t, err)
+		new, err := newRoot.LoadMast(ctx, &config)
+		require.NoError(t, err)
+		store.loads = 0
+		dc, err := new.StartDiffRange(ctx, old, lo, hi)
+		require.NoError(t, err)
+		var keys []interface{}
+		for {
+			d, err := dc.NextEntry(ctx)
+			if err == ErrNoMoreDiffs {
+				break
+			}
+			require.NoError(t, err)
+			keys = append(keys, d.Key)
+		}
+		return keys, store.loads
+	}
+	allKeys, allLoads := diffLoads(nil, nil)
+	require.Equal(t, []interface{}{"a/0500", "b/0500", "c/0500", "d/0500"}, allKeys)
+	tenantKeys, tenantLoads := diffLoads("b/", "b0")
+	require.Equal(t, []interface{}{"b/0500"}, tenantKeys)
+	require.Less(t, tenantLoads, allLoads)
+}
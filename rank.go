@@ -0,0 +1,164 @@
+package mast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrIndexOutOfRange is returned when selecting an entry past the end of the tree.
+var ErrIndexOutOfRange = errors.New("index out of range")
+
+// Rank returns the number of entries with keys less than the given key. Subtrees are
+// counted without being loaded when the tree uses the V115BinaryCounted node format.
+func (m *Mast) Rank(ctx context.Context, key interface{}) (uint64, error) {
+	if m.root == nil {
+		return 0, nil
+	}
+	node, err := m.load(ctx, m.root)
+	if err != nil {
+		return 0, fmt.Errorf("load root: %w", err)
+	}
+	var rank uint64
+	for {
+		i, found, err := node.search(m, key)
+		if err != nil {
+			return 0, err
+		}
+		for j := 0; j < i; j++ {
+			n, err := node.childSize(ctx, m, j)
+			if err != nil {
+				return 0, fmt.Errorf("size: %w", err)
+			}
+			rank += n + 1
+		}
+		if found {
+			n, err := node.childSize(ctx, m, i)
+			if err != nil {
+				return 0, fmt.Errorf("size: %w", err)
+			}
+			return rank + n, nil
+		}
+		if node.Link[i] == nil {
+			return rank, nil
+		}
+		node, err = m.load(ctx, node.Link[i])
+		if err != nil {
+			return 0, fmt.Errorf("load: %w", err)
+		}
+	}
+}
+
+// Select returns the key and value of the entry with the given zero-based position in key
+// order, or ErrIndexOutOfRange if the tree doesn't have that many entries.
+func (m *Mast) Select(ctx context.Context, i uint64) (interface{}, interface{}, error) {
+	path, err := m.selectPath(ctx, i)
+	if err != nil {
+		return nil, nil, err
+	}
+	if path == nil {
+		return nil, nil, ErrIndexOutOfRange
+	}
+	pe := path[len(path)-1]
+	return pe.node.Key[pe.linkIndex], pe.node.Value[pe.linkIndex], nil
+}
+
+// CountRange returns the number of entries with keys from lo (inclusive) up to hi
+// (exclusive). A nil lo or hi leaves that end of the range unbounded.
+func (m *Mast) CountRange(ctx context.Context, lo, hi interface{}) (uint64, error) {
+	var loRank uint64
+	if lo != nil {
+		var err error
+		loRank, err = m.Rank(ctx, lo)
+		if err != nil {
+			return 0, fmt.Errorf("rank lo: %w", err)
+		}
+	}
+	hiRank := m.size
+	if hi != nil {
+		var err error
+		hiRank, err = m.Rank(ctx, hi)
+		if err != nil {
+			return 0, fmt.Errorf("rank hi: %w", err)
+		}
+	}
+	if hiRank < loRank {
+		return 0, nil
+	}
+	return hiRank - loRank, nil
+}
+
+// Seek moves the cursor to the entry with the given zero-based position in key order. If
+// the tree doesn't have that many entries, the cursor is left with no entry.
+func (c *Cursor) Seek(ctx context.Context, i uint64) error {
+	path, err := c.m.selectPath(ctx, i)
+	if err != nil {
+		return err
+	}
+	c.path = path
+	return nil
+}
+
+// selectPath returns the path to the entry at the given position, or nil if there is none.
+// Ancestors' linkIndex is the link that was followed, as left by Cursor.Ceil.
+func (m *Mast) selectPath(ctx context.Context, i uint64) ([]pathEntry, error) {
+	if m.root == nil || i >= m.size {
+		return nil, nil
+	}
+	node, err := m.load(ctx, m.root)
+	if err != nil {
+		return nil, fmt.Errorf("load root: %w", err)
+	}
+	var path []pathEntry
+	for {
+		var j int
+		for j = 0; j < len(node.Link); j++ {
+			n, err := node.childSize(ctx, m, j)
+			if err != nil {
+				return nil, fmt.Errorf("size: %w", err)
+			}
+			if i < n {
+				break
+			}
+			i -= n
+			if j == len(node.Key) {
+				return nil, fmt.Errorf("tree has fewer entries than its size")
+			}
+			if i == 0 {
+				return append(path, pathEntry{node, j}), nil
+			}
+			i--
+		}
+		path = append(path, pathEntry{node, j})
+		node, err = m.load(ctx, node.Link[j])
+		if err != nil {
+			return nil, fmt.Errorf("load: %w", err)
+		}
+	}
+}
+
+// search returns the index of the first key in the node that is not less than the given
+// key, and whether that key is equal to it.
+func (node *mastNode) search(m *Mast, key interface{}) (int, bool, error) {
+	var err error
+	i := sort.Search(len(node.Key), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var cmp int
+		cmp, err = m.keyOrder(key, node.Key[i])
+		return cmp <= 0
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("keyCompare: %w", err)
+	}
+	if i == len(node.Key) {
+		return i, false, nil
+	}
+	cmp, err := m.keyOrder(key, node.Key[i])
+	if err != nil {
+		return 0, false, fmt.Errorf("keyCompare: %w", err)
+	}
+	return i, cmp == 0, nil
+}
@@ -0,0 +1,171 @@
+package mast
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/arbitrary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankSelectProperty(t *testing.T) {
+	t.Parallel()
+	properties := gopter.NewProperties(defaultGopterParameters)
+	arbitraries := arbitrary.DefaultArbitraries()
+	properties.Property("rank and select agree with sorted keys",
+		arbitraries.ForAll(
+			func(keys []uint16, deletes []uint16, probe, lo, hi uint, counted, flush bool) bool {
+				m := newTestTree(uint(0), uint(0))
+				m.branchFactor = 4
+				m.growAfterSize = 4
+				if counted {
+					m.nodeFormat = V115BinaryCounted
+				}
+				present := map[uint]bool{}
+				for _, k := range keys {
+					require.NoError(t, m.Insert(ctx, uint(k), uint(k)))
+					present[uint(k)] = true
+				}
+				if flush {
+					_, err := m.flush(ctx)
+					require.NoError(t, err)
+				}
+				for _, k := range deletes {
+					if present[uint(k)] {
+						require.NoError(t, m.Delete(ctx, uint(k), uint(k)))
+						delete(present, uint(k))
+					}
+				}
+				sorted := []uint{}
+				for k := range present {
+					sorted = append(sorted, k)
+				}
+				sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+				for i, k := range sorted {
+					key, value, err := m.Select(ctx, uint64(i))
+					require.NoError(t, err)
+					if !assert.Equal(t, k, key) || !assert.Equal(t, k, value) {
+						return false
+					}
+					rank, err := m.Rank(ctx, k)
+					require.NoError(t, err)
+					if !assert.Equal(t, uint64(i), rank) {
+						return false
+					}
+				}
+				_, _, err := m.Select(ctx, uint64(len(sorted)))
+				if !assert.Equal(t, ErrIndexOutOfRange, err) {
+					return false
+				}
+				expectedRank := uint64(sort.Search(len(sorted), func(i int) bool { return sorted[i] >= probe }))
+				rank, err := m.Rank(ctx, probe)
+				require.NoError(t, err)
+				expectedCount := uint64(0)
+				for _, k := range sorted {
+					if k >= lo && k < hi {
+						expectedCount++
+					}
+				}
+				count, err := m.CountRange(ctx, lo, hi)
+				require.NoError(t, err)
+				return assert.Equal(t, expectedRank, rank) && assert.Equal(t, expectedCount, count)
+			}))
+	properties.TestingRun(t)
+}
+
+func TestCursorSeek(t *testing.T) {
+	t.Parallel()
+	m := NewInMemory()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	c, err := m.Cursor(ctx)
+	require.NoError(t, err)
+	for _, i := range []int{0, 1, 15, 16, 500, 999} {
+		require.NoError(t, c.Seek(ctx, uint64(i)))
+		k, v, ok := c.Get()
+		require.True(t, ok)
+		require.Equal(t, i, k)
+		require.Equal(t, i, v)
+	}
+	require.NoError(t, c.Seek(ctx, 250))
+	for i := 250; i < 1000; i++ {
+		k, _, ok := c.Get()
+		require.True(t, ok)
+		require.Equal(t, i, k)
+		require.NoError(t, c.Forward(ctx))
+	}
+	_, _, ok := c.Get()
+	require.False(t, ok)
+	require.NoError(t, c.Seek(ctx, 1000))
+	_, _, ok = c.Get()
+	require.False(t, ok)
+}
+
+func TestCountedFormatAvoidsLoads(t *testing.T) {
+	t.Parallel()
+	loads := func(nf nodeFormat) int {
+		store := &countingStore{Persist: NewInMemoryStore()}
+		config := RemoteConfig{
+			KeysLike:                "",
+			ValuesLike:              0,
+			StoreImmutablePartsWith: store,
+		}
+		m, err := NewRoot(&CreateRemoteOptions{NodeFormat: nf}).LoadMast(ctx, &config)
+		require.NoError(t, err)
+		for i := 0; i < 5000; i++ {
+			require.NoError(t, m.Insert(ctx, fmt.Sprintf("%05d", i), i))
+		}
+		root, err := m.MakeRoot(ctx)
+		require.NoError(t, err)
+		require.Equal(t, string(nf), root.NodeFormat)
+		m, err = root.LoadMast(ctx, &config)
+		require.NoError(t, err)
+		store.loads = 0
+		key, value, err := m.Select(ctx, 3210)
+		require.NoError(t, err)
+		require.Equal(t, "03210", key)
+		require.Equal(t, 3210, value)
+		rank, err := m.Rank(ctx, "04321")
+		require.NoError(t, err)
+		require.Equal(t, uint64(4321), rank)
+		count, err := m.CountRange(ctx, "01000", "02000")
+		require.NoError(t, err)
+		require.Equal(t, uint64(1000), count)
+		return store.loads
+	}
+	counted := loads(V115BinaryCounted)
+	require.Less(t, counted, 20)
+	require.Less(t, counted, loads(V115Binary))
+}
+
+func TestCountedFormatFlushLoads(t *testing.T) {
+	t.Parallel()
+	store := &countingStore{Persist: NewInMemoryStore()}
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store}
+	options := CreateRemoteOptions{NodeFormat: V115BinaryCounted, BranchFactor: 4}
+	m, err := NewRoot(&options).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 5000; i += 2 {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+
+	for _, key := range []int{2501, 7, 4999} {
+		m, err = root.LoadMast(ctx, &config)
+		require.NoError(t, err)
+		require.NoError(t, m.Insert(ctx, key, key))
+		store.loads = 0
+		changed, err := m.MakeRoot(ctx)
+		require.NoError(t, err)
+		require.Zero(t, store.loads, "unchanged subtrees should not be loaded to be counted")
+		report, err := Verify(ctx, changed, &config)
+		require.NoError(t, err)
+		require.True(t, report.OK(), "%v", report.Problems)
+		require.Equal(t, uint64(2501), report.Entries)
+	}
+}
@@ -0,0 +1,144 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// prefetcher loads nodes in the background, ahead of when they're needed, so that scans
+// aren't limited by the round-trip time to the Persist. Loaded nodes are put in the tree's
+// NodeCache, or in a private one if the tree doesn't have one.
+type prefetcher struct {
+	gate  chan struct{}
+	cache NodeCache
+	// private indicates the cache is only for prefetched nodes, so loadPersisted won't
+	// look there.
+	private bool
+	l       sync.Mutex
+	// loads has the nodes being loaded, by cache key.
+	loads map[string]*prefetch
+	limit int
+}
+
+type prefetch struct {
+	done chan struct{}
+	node *mastNode
+	err  error
+}
+
+func newPrefetcher(concurrency int, cache NodeCache) *prefetcher {
+	p := &prefetcher{
+		gate:  make(chan struct{}, concurrency),
+		cache: cache,
+		loads: map[string]*prefetch{},
+		limit: 4 * concurrency,
+	}
+	if p.cache == nil {
+		p.cache = NewNodeCache(8 * concurrency)
+		p.private = true
+	}
+	return p
+}
+
+// prefetch starts loading the nodes at the given links that aren't already loaded or
+// being loaded. Nothing more is started while the limit of loads in progress is reached.
+func (m *Mast) prefetch(ctx context.Context, links []interface{}) {
+	p := m.prefetcher
+	if p == nil {
+		return
+	}
+	for _, link := range links {
+		name, ok := link.(string)
+		if !ok {
+			continue
+		}
+		cacheKey := fmt.Sprintf("%s/%s", m.persist.NodeURLPrefix(), name)
+		if hasNode(p.cache, cacheKey) {
+			continue
+		}
+		p.l.Lock()
+		if p.loads[cacheKey] != nil || len(p.loads) >= p.limit {
+			p.l.Unlock()
+			continue
+		}
+		f := &prefetch{done: make(chan struct{})}
+		p.loads[cacheKey] = f
+		p.l.Unlock()
+		go p.fetch(ctx, m, name, cacheKey, f)
+	}
+}
+
+func (p *prefetcher) fetch(ctx context.Context, m *Mast, name, cacheKey string, f *prefetch) {
+	defer func() {
+		p.l.Lock()
+		delete(p.loads, cacheKey)
+		p.l.Unlock()
+		close(f.done)
+	}()
+	select {
+	case p.gate <- struct{}{}:
+	case <-ctx.Done():
+		f.err = ctx.Err()
+		return
+	}
+	defer func() { <-p.gate }()
+	var size int
+	f.node, size, f.err = m.loadNode(ctx, name, cacheKey)
+	if f.err != nil {
+		return
+	}
+	validateNode(ctx, f.node, m)
+	addToCache(p.cache, cacheKey, f.node, size)
+}
+
+// take returns the node with the given cache key, if it was prefetched, waiting for it if
+// it is still being loaded. Returns nil if the node wasn't prefetched or couldn't be, so
+// the caller should load it itself.
+func (p *prefetcher) take(ctx context.Context, cacheKey string) *mastNode {
+	p.l.Lock()
+	f := p.loads[cacheKey]
+	p.l.Unlock()
+	if f != nil {
+		select {
+		case <-f.done:
+			if f.err == nil {
+				return f.node
+			}
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if p.private {
+		if node, ok := p.cache.Get(cacheKey); ok {
+			return node.(*mastNode)
+		}
+	}
+	return nil
+}
+
+// prefetchLinks prefetches the links of the given node, except for those that the other
+// given node, if any, also has, which a diff won't need to visit.
+func (m *Mast) prefetchLinks(ctx context.Context, node, except *mastNode) {
+	if m.prefetcher == nil {
+		return
+	}
+	if except == nil {
+		m.prefetch(ctx, node.Link)
+		return
+	}
+	shared := map[interface{}]bool{}
+	for _, link := range except.Link {
+		if _, ok := link.(string); ok {
+			shared[link] = true
+		}
+	}
+	var links []interface{}
+	for _, link := range node.Link {
+		if !shared[link] {
+			links = append(links, link)
+		}
+	}
+	m.prefetch(ctx, links)
+}
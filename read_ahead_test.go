@@ -0,0 +1,129 @@
+package mast
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowLoadStore delays loads, and records the most it has had in flight at once.
+type slowLoadStore struct {
+	Persist
+	l                         sync.Mutex
+	loads, inFlight, maxSoFar int
+}
+
+func (s *slowLoadStore) Load(ctx context.Context, name string) ([]byte, error) {
+	s.l.Lock()
+	s.loads++
+	s.inFlight++
+	if s.inFlight > s.maxSoFar {
+		s.maxSoFar = s.inFlight
+	}
+	s.l.Unlock()
+	time.Sleep(time.Millisecond)
+	s.l.Lock()
+	s.inFlight--
+	s.l.Unlock()
+	return s.Persist.Load(ctx, name)
+}
+
+func (s *slowLoadStore) reset() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	max := s.maxSoFar
+	s.loads, s.maxSoFar = 0, 0
+	return max
+}
+
+func newReadAheadTestTrees(t *testing.T, readAhead int) (*Mast, *Mast, *slowLoadStore) {
+	store := &slowLoadStore{Persist: NewInMemoryStore()}
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store, ReadAhead: readAhead}
+	m, err := NewRoot(&CreateRemoteOptions{BranchFactor: 4}).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	oldRoot, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	for i := 0; i < 2000; i += 37 {
+		require.NoError(t, m.Insert(ctx, i, -i))
+	}
+	require.NoError(t, m.Insert(ctx, 5000, 5000))
+	newRoot, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	oldMast, err := oldRoot.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	newMast, err := newRoot.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	store.reset()
+	return oldMast, newMast, store
+}
+
+func collectReads(t *testing.T, oldMast, newMast *Mast) ([]int, []int, []int, []int, []int) {
+	var all, seeked, ranged, reversed, diffs []int
+	require.NoError(t, newMast.Iter(ctx, func(k, _ interface{}) error {
+		all = append(all, k.(int))
+		return nil
+	}))
+	require.NoError(t, newMast.SeekIter(ctx, 1000, func(k, _ interface{}) error {
+		seeked = append(seeked, k.(int))
+		return nil
+	}))
+	require.NoError(t, newMast.IterRange(ctx, 500, 1500, true, false, func(k, _ interface{}) error {
+		ranged = append(ranged, k.(int))
+		return nil
+	}))
+	require.NoError(t, newMast.IterRangeReverse(ctx, 500, 1500, true, false, func(k, _ interface{}) error {
+		reversed = append(reversed, k.(int))
+		return nil
+	}))
+	require.NoError(t, newMast.DiffIter(ctx, oldMast, func(_, _ bool, k, _, _ interface{}) (bool, error) {
+		diffs = append(diffs, k.(int))
+		return true, nil
+	}))
+	return all, seeked, ranged, reversed, diffs
+}
+
+func TestReadAhead(t *testing.T) {
+	t.Parallel()
+	oldMast, newMast, _ := newReadAheadTestTrees(t, 0)
+	eAll, eSeeked, eRanged, eReversed, eDiffs := collectReads(t, oldMast, newMast)
+	require.Len(t, eAll, 2001)
+	require.Len(t, eReversed, 1000)
+	require.Len(t, eDiffs, 55)
+
+	oldMast, newMast, store := newReadAheadTestTrees(t, 8)
+	all, seeked, ranged, reversed, diffs := collectReads(t, oldMast, newMast)
+	require.Equal(t, eAll, all)
+	require.Equal(t, eSeeked, seeked)
+	require.Equal(t, eRanged, ranged)
+	require.Equal(t, eReversed, reversed)
+	require.Equal(t, eDiffs, diffs)
+	maxSoFar := store.reset()
+	require.Greater(t, maxSoFar, 1)
+	require.LessOrEqual(t, maxSoFar, 8)
+}
+
+func TestReadAheadCancel(t *testing.T) {
+	t.Parallel()
+	_, newMast, _ := newReadAheadTestTrees(t, 8)
+	ctx, cancel := context.WithCancel(ctx)
+	seen := 0
+	err := newMast.Iter(ctx, func(_, _ interface{}) error {
+		seen++
+		if seen == 10 {
+			cancel()
+		}
+		return ctx.Err()
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Eventually(t, func() bool {
+		newMast.prefetcher.l.Lock()
+		defer newMast.prefetcher.l.Unlock()
+		return len(newMast.prefetcher.loads) == 0
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,80 @@
+package mast
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ErrRootConflict is returned by RootStore.CompareAndSwap when the stored root is not the
+// expected one, because someone else has changed it.
+var ErrRootConflict = errors.New("root was changed concurrently")
+
+// RootStore keeps named pointers to Roots, like branches, that can be updated with
+// optimistic concurrency: read a root with Get, make a new version of the tree with
+// LoadMast and MakeRoot, then CompareAndSwap it in, starting over on ErrRootConflict.
+type RootStore interface {
+	// Get returns the root with the given name, or nil if there isn't one.
+	Get(ctx context.Context, name string) (*Root, error)
+	// CompareAndSwap sets the root with the given name to new, if it is currently old
+	// (nil meaning there is no root with the name yet), or returns ErrRootConflict, which
+	// may be wrapped. new must not be nil.
+	CompareAndSwap(ctx context.Context, name string, old, new *Root) error
+}
+
+// Equal indicates the roots refer to the same version of a tree. Nil roots are only equal
+// to each other.
+func (r *Root) Equal(other *Root) bool {
+	if r == nil || other == nil {
+		return r == other
+	}
+	return reflect.DeepEqual(*r, *other)
+}
+
+type inMemoryRootStore struct {
+	roots map[string]Root
+	l     sync.Mutex
+}
+
+// NewInMemoryRootStore provides a RootStore that keeps roots in a map, usually for testing.
+func NewInMemoryRootStore() RootStore {
+	return &inMemoryRootStore{roots: map[string]Root{}}
+}
+
+func (rs *inMemoryRootStore) Get(ctx context.Context, name string) (*Root, error) {
+	rs.l.Lock()
+	root, ok := rs.roots[name]
+	rs.l.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	return root.copy(), nil
+}
+
+func (rs *inMemoryRootStore) CompareAndSwap(ctx context.Context, name string, old, new *Root) error {
+	if new == nil {
+		return errors.New("cannot swap in a nil root")
+	}
+	rs.l.Lock()
+	defer rs.l.Unlock()
+	var current *Root
+	if root, ok := rs.roots[name]; ok {
+		current = &root
+	}
+	if !current.Equal(old) {
+		return ErrRootConflict
+	}
+	rs.roots[name] = *new.copy()
+	return nil
+}
+
+// copy returns a root that doesn't share its Link with r.
+func (r *Root) copy() *Root {
+	res := *r
+	if r.Link != nil {
+		link := *r.Link
+		res.Link = &link
+	}
+	return &res
+}
@@ -0,0 +1,13 @@
+package mast_test
+
+import (
+	"testing"
+
+	"github.com/jrhy/mast"
+	"github.com/jrhy/mast/persist/persisttest"
+)
+
+func TestInMemoryRootStore(t *testing.T) {
+	t.Parallel()
+	persisttest.RootStore(t, mast.NewInMemoryRootStore())
+}
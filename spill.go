@@ -0,0 +1,126 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// FlushStats counts the nodes a tree has written to its Persist.
+type FlushStats struct {
+	// Nodes is the number of nodes stored.
+	Nodes uint64
+	// Bytes is the total size of the nodes stored.
+	Bytes uint64
+	// Spills is the number of times nodes were stored early to keep within
+	// RemoteConfig.DirtyNodeBudget.
+	Spills uint64
+}
+
+// FlushStats returns counts of what the tree has stored so far, by MakeRoot and by keeping
+// within its DirtyNodeBudget. It may be called while MakeRoot is running, to follow its
+// progress.
+func (m *Mast) FlushStats() FlushStats {
+	return FlushStats{
+		Nodes:  atomic.LoadUint64(&m.flushStats.Nodes),
+		Bytes:  atomic.LoadUint64(&m.flushStats.Bytes),
+		Spills: atomic.LoadUint64(&m.flushStats.Spills),
+	}
+}
+
+// statsPersist counts what is stored through it.
+type statsPersist struct {
+	Persist
+	stats *FlushStats
+}
+
+func (p statsPersist) Store(ctx context.Context, name string, b []byte) error {
+	err := p.Persist.Store(ctx, name, b)
+	if err != nil {
+		return err
+	}
+	atomic.AddUint64(&p.stats.Nodes, 1)
+	atomic.AddUint64(&p.stats.Bytes, uint64(len(b)))
+	return nil
+}
+
+// noteDirty accounts for a change to the given number of entries, each of which may have
+// dirtied a path's worth of nodes. If that might take the tree over its DirtyNodeBudget, the
+// dirty nodes are counted, and the subtrees under the root are stored if there are more than
+// half the budget, which keeps the cost of counting proportional to the changes made. The
+// change has already been made when it is called, so an error storing the subtrees
+// doesn't undo it.
+func (m *Mast) noteDirty(ctx context.Context, entries int) error {
+	if m.dirtyNodeBudget == 0 {
+		return nil
+	}
+	m.dirtyEstimate += uint64(entries) * (uint64(m.height) + 1)
+	if m.dirtyEstimate <= m.dirtyNodeBudget {
+		return nil
+	}
+	m.dirtyEstimate = countDirty(m.root)
+	if m.dirtyEstimate <= m.dirtyNodeBudget/2 {
+		return nil
+	}
+	return m.spill(ctx)
+}
+
+// countDirty returns the number of dirty nodes in the subtree at the given link.
+func countDirty(link interface{}) uint64 {
+	node, ok := link.(*mastNode)
+	if !ok || !node.dirty {
+		return 0
+	}
+	count := uint64(1)
+	for _, child := range node.Link {
+		count += countDirty(child)
+	}
+	return count
+}
+
+// spill stores the dirty subtrees under the root, replacing them with links to what was
+// stored, so that only the root remains dirty. Only the root's links are replaced, so each
+// subtree under it is stored whole, however many dirty nodes it has.
+func (m *Mast) spill(ctx context.Context) error {
+	if m.persist == nil {
+		return fmt.Errorf("no persistence mechanism set; set RemoteConfig.StoreImmutablePartsWith")
+	}
+	root, ok := m.root.(*mastNode)
+	if !ok || !root.dirty {
+		return nil
+	}
+	err := m.checkEntryTypes()
+	if err != nil {
+		return err
+	}
+	marshal := m.nodeMarshaler()
+	sizer := m.nodeSizer()
+	q := m.newStoreQueue(nil)
+	q.resume(ctx)
+	spilled := false
+	for i, link := range root.Link {
+		child, ok := link.(*mastNode)
+		if !ok || !child.dirty {
+			continue
+		}
+		var name string
+		name, err = child.store(ctx, m.nodeCache, marshal, sizer, q)
+		if err != nil {
+			break
+		}
+		root.Link[i] = name
+		spilled = true
+	}
+	storeErr := q.wait()
+	if err != nil {
+		return fmt.Errorf("spill: %w", err)
+	}
+	if storeErr != nil {
+		return fmt.Errorf("spill: %w", storeErr)
+	}
+	if spilled {
+		atomic.AddUint64(&m.flushStats.Spills, 1)
+	}
+	m.dirtyEstimate = 1
+	return nil
+}
@@ -0,0 +1,89 @@
+package mast
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirtyNodeBudget(t *testing.T) {
+	t.Parallel()
+	const budget = 50
+	for _, nf := range []nodeFormat{V115Binary, V115BinaryCounted} {
+		config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: NewInMemoryStore()}
+		unbounded, err := NewRoot(&CreateRemoteOptions{NodeFormat: nf}).LoadMast(ctx, &config)
+		require.NoError(t, err)
+		config.DirtyNodeBudget = budget
+		bounded, err := NewRoot(&CreateRemoteOptions{NodeFormat: nf}).LoadMast(ctx, &config)
+		require.NoError(t, err)
+
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 5_000; i++ {
+			key := r.Intn(20_000)
+			if i%5 == 0 {
+				_, _, err = unbounded.DeleteKey(ctx, key)
+				require.NoError(t, err)
+				_, _, err = bounded.DeleteKey(ctx, key)
+				require.NoError(t, err)
+				continue
+			}
+			require.NoError(t, unbounded.Insert(ctx, key, i))
+			require.NoError(t, bounded.Insert(ctx, key, i))
+			require.LessOrEqual(t, countDirty(bounded.root), uint64(budget))
+		}
+		require.Greater(t, countDirty(unbounded.root), uint64(budget))
+		stats := bounded.FlushStats()
+		require.NotZero(t, stats.Spills)
+		require.NotZero(t, stats.Nodes)
+		require.Zero(t, unbounded.FlushStats().Nodes)
+
+		expected, err := unbounded.MakeRoot(ctx)
+		require.NoError(t, err)
+		actual, err := bounded.MakeRoot(ctx)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+		require.Greater(t, bounded.FlushStats().Nodes, stats.Nodes)
+		require.Greater(t, bounded.FlushStats().Bytes, stats.Bytes)
+		require.Equal(t, stats.Spills, bounded.FlushStats().Spills)
+	}
+}
+
+func TestDirtyNodeBudgetStoreError(t *testing.T) {
+	t.Parallel()
+	store := &failingStore{Persist: NewInMemoryStore()}
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: store, DirtyNodeBudget: 10}
+	m, err := NewRoot(&CreateRemoteOptions{BranchFactor: 4}).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	i := 0
+	for ; err == nil; i++ {
+		err = m.Insert(ctx, i, i)
+	}
+	require.ErrorContains(t, err, "out of space")
+
+	// the change that failed to spill is still applied
+	var v int
+	found, err := m.Get(ctx, i-1, &v)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, uint64(i), m.Size())
+
+	store.l.Lock()
+	store.remaining = -1
+	store.l.Unlock()
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	report, err := Verify(ctx, root, &config)
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Problems)
+	require.Equal(t, uint64(i), report.Entries)
+}
+
+func TestNegativeDirtyNodeBudget(t *testing.T) {
+	t.Parallel()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: NewInMemoryStore(), DirtyNodeBudget: -1}
+	_, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.ErrorContains(t, err, "DirtyNodeBudget")
+	_, err = NewBulkLoader(&config, nil)
+	require.ErrorContains(t, err, "DirtyNodeBudget")
+}
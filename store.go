@@ -40,47 +40,111 @@ func (m *Mast) loadPersisted(ctx context.Context, l string) (*mastNode, error) {
 			return node.(*mastNode), nil
 		}
 	}
-	nodeBytes, err := m.persist.Load(ctx, l)
+	if m.prefetcher != nil {
+		if node := m.prefetcher.take(ctx, cacheKey); node != nil {
+			return node, nil
+		}
+	}
+	if nodeBytes, ok := m.pendingStores[l]; ok {
+		// a failed flush or spill already linked to the node, but didn't store it; it
+		// isn't cached, since the cache would then say it had been stored
+		return m.decodeNode(nodeBytes, l)
+	}
+	node, size, err := m.loadNode(ctx, l, cacheKey)
 	if err != nil {
-		return nil, fmt.Errorf("persist load %s: %w", l, err)
+		return nil, err
 	}
 
-	versionedUnmarshaler := func(m *Mast, nodeBytes []byte, l string, node *mastNode) error {
-		switch m.nodeFormat {
-		case V1Marshaler:
-			return unmarshalNode(m, nodeBytes, l, node)
-		case V115Binary:
-			err := unmarshalMastNode(m, nodeBytes, node)
-			if err != nil {
-				return err
-			}
-			if len(node.Link) == 0 {
-				node.Link = make([]interface{}, len(node.Key)+1)
-			}
-			node.shared = true
-			if debugMutation {
-				node.expected = node.xcopy()
+	if m.debug {
+		fmt.Printf("loaded node %s->%v\n", l, *node)
+	}
+	validateNode(ctx, node, m)
+	if m.nodeCache != nil {
+		addToCache(m.nodeCache, cacheKey, node, size)
+	}
+	return node, nil
+}
+
+// loadNode loads and deserializes the node with the given name, from the NodeCache's
+// serialized bytes if it keeps them, otherwise from the Persist. Also returns the node's
+// serialized size.
+func (m *Mast) loadNode(ctx context.Context, l, cacheKey string) (*mastNode, int, error) {
+	bc, _ := m.nodeCache.(bytesCache)
+	if bc != nil {
+		if nodeBytes, ok := bc.getBytes(cacheKey); ok {
+			// the cached bytes are local state that could have been damaged, even into
+			// another well-formed node, so are always checked
+			if checkNodeHash(l, nodeBytes) == nil {
+				node, err := m.decodeNode(nodeBytes, l)
+				if err == nil {
+					return node, len(nodeBytes), nil
+				}
 			}
-			node.source = &l
-			return nil
+			// the cached bytes were damaged, so replace them from the Persist
+			bc.removeBytes(cacheKey)
 		}
-		return fmt.Errorf("unknown node format '%v'", m.nodeFormat)
 	}
-
-	var node mastNode
-	err = versionedUnmarshaler(m, nodeBytes, l, &node)
+	nodeBytes, err := m.persist.Load(ctx, l)
 	if err != nil {
-		return nil, err
+		return nil, 0, fmt.Errorf("persist load %s: %w", l, err)
+	}
+	node, err := m.decodeCheckedNode(nodeBytes, l)
+	if err != nil {
+		return nil, 0, err
 	}
+	if bc != nil {
+		bc.addBytes(cacheKey, nodeBytes)
+	}
+	return node, len(nodeBytes), nil
+}
 
-	if m.debug {
-		fmt.Printf("loaded node %s->%v\n", l, node)
+// decodeCheckedNode is like decodeNode, but first checks that the bytes hash to the node's
+// name if the tree was configured to verify nodes.
+func (m *Mast) decodeCheckedNode(nodeBytes []byte, l string) (*mastNode, error) {
+	if m.verifyNodes {
+		err := checkNodeHash(l, nodeBytes)
+		if err != nil {
+			return nil, err
+		}
 	}
-	validateNode(ctx, &node, m)
-	if m.nodeCache != nil {
-		m.nodeCache.Add(cacheKey, &node)
+	return m.decodeNode(nodeBytes, l)
+}
+
+// decodeNode deserializes the node persisted with the given name, according to the tree's
+// node format.
+func (m *Mast) decodeNode(nodeBytes []byte, l string) (*mastNode, error) {
+	var node mastNode
+	switch m.nodeFormat {
+	case V1Marshaler:
+		err := unmarshalNode(m, nodeBytes, l, &node)
+		if err != nil {
+			return nil, err
+		}
+		return &node, nil
+	case V115Binary, V115BinaryCounted:
+		var err error
+		if m.nodeFormat == V115BinaryCounted {
+			err = unmarshalCountedMastNode(m, nodeBytes, &node)
+		} else {
+			err = unmarshalMastNode(m, nodeBytes, &node)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(node.Link) == 0 {
+			node.Link = make([]interface{}, len(node.Key)+1)
+			if m.nodeFormat == V115BinaryCounted {
+				node.linkCount = make([]uint64, len(node.Link))
+			}
+		}
+		node.shared = true
+		if debugMutation {
+			node.expected = node.xcopy()
+		}
+		node.source = &l
+		return &node, nil
 	}
-	return &node, nil
+	return nil, fmt.Errorf("unknown node format '%v'", m.nodeFormat)
 }
 
 func unmarshalNode(m *Mast, nodeBytes []byte, l string, node *mastNode) error {
@@ -99,13 +163,16 @@ func unmarshalStringNode(m *Mast, nodeBytes []byte, l string, node *mastNode) er
 	if len(stringNode.Key) != len(stringNode.Value) {
 		return fmt.Errorf("cannot unmarshal %s: mismatched keys and values", l)
 	}
+	if len(stringNode.Link) != 0 && len(stringNode.Link) != len(stringNode.Key)+1 {
+		return fmt.Errorf("cannot unmarshal %s: mismatched keys and links", l)
+	}
 	*node = mastNode{
 		Node{
 			make([]interface{}, len(stringNode.Key)),
 			make([]interface{}, len(stringNode.Value)),
 			make([]interface{}, len(stringNode.Key)+1),
 		},
-		false, true, nil, &l,
+		false, true, nil, &l, nil, nil,
 	}
 	for i := 0; i < len(stringNode.Key); i++ {
 		aType := reflect.TypeOf(m.zeroKey)
@@ -175,14 +242,59 @@ func (m *Mast) store(node *mastNode) (interface{}, error) {
 	return node, nil
 }
 
+// checkEntryTypes ensures the tree will be able to unmarshal the entries it persists.
+func (m *Mast) checkEntryTypes() error {
+	if !m.unmarshalerUsesRegisteredTypes && (m.zeroKey == nil || m.zeroValue == nil) {
+		return errors.New("will not be able to figure out which type to unmarshal entries as; set RemoteConfig.{Keys,Values}Like or UnmarshalerUsesRegisteredTypes")
+	}
+	return nil
+}
+
+// nodeMarshaler returns a function that serializes nodes in the tree's node format.
+func (m *Mast) nodeMarshaler() func(interface{}) ([]byte, error) {
+	return func(i interface{}) ([]byte, error) {
+		switch m.nodeFormat {
+		case V1Marshaler:
+			switch x := i.(type) {
+			case mastNode:
+				return m.marshal(x.Node)
+			default:
+				return m.marshal(x)
+			}
+		case V115Binary:
+			node, ok := i.(mastNode)
+			if !ok {
+				return nil, fmt.Errorf("expected mast.mastNode, got %T", i)
+			}
+			return marshalMastNode(&node, m.marshal)
+		case V115BinaryCounted:
+			node, ok := i.(mastNode)
+			if !ok {
+				return nil, fmt.Errorf("expected mast.mastNode, got %T", i)
+			}
+			return marshalCountedMastNode(&node, m.marshal)
+		}
+		return nil, fmt.Errorf("unknown node format '%v'", m.nodeFormat)
+	}
+}
+
+// nodeSizer returns the function for counting the entries under each link, for node
+// formats that persist the counts, or nil.
+func (m *Mast) nodeSizer() func(context.Context, interface{}) (uint64, error) {
+	if m.nodeFormat == V115BinaryCounted {
+		return m.linkSize
+	}
+	return nil
+}
+
 const debugMutation = false
 
 func (node *mastNode) store(
 	ctx context.Context,
-	persist Persist,
 	cache NodeCache,
 	marshal func(interface{}) ([]byte, error),
-	storeQ chan func() error,
+	sizer func(context.Context, interface{}) (uint64, error),
+	q *storeQueue,
 ) (string, error) {
 	if !node.dirty {
 		if debugMutation && node.expected != nil {
@@ -208,6 +320,10 @@ func (node *mastNode) store(
 		}
 	}
 
+	var counts []uint64
+	if sizer != nil {
+		counts = make([]uint64, len(node.Link))
+	}
 	linkCount := 0
 	for i, il := range node.Link {
 		if il == nil {
@@ -218,7 +334,7 @@ func (node *mastNode) store(
 		case string:
 			break
 		case *mastNode:
-			newLink, err := l.store(ctx, persist, cache, marshal, storeQ)
+			newLink, err := l.store(ctx, cache, marshal, sizer, q)
 			if err != nil {
 				return "", fmt.Errorf("flush: %w", err)
 			}
@@ -226,33 +342,46 @@ func (node *mastNode) store(
 		default:
 			return "", fmt.Errorf("don't know how to flush link of type %T", l)
 		}
+		if sizer != nil {
+			var ok bool
+			if name, isName := il.(string); isName {
+				counts[i], ok = node.storedCount(name)
+			}
+			if !ok {
+				var err error
+				counts[i], err = sizer(ctx, il)
+				if err != nil {
+					return "", fmt.Errorf("size: %w", err)
+				}
+			}
+		}
 	}
+	node.linkCount = counts
+	node.counted = nil
 	trimmed := *node
 	if linkCount == 0 {
 		trimmed.Link = nil
+		trimmed.linkCount = nil
 	}
 	encoded, err := marshal(trimmed)
 	if err != nil {
 		return "", fmt.Errorf("marshal: %w", err)
 	}
-	hashBytes := blake2b.Sum256(encoded)
-	hash := base64.RawURLEncoding.EncodeToString(hashBytes[:])
-	cacheKey := fmt.Sprintf("%s/%s", persist.NodeURLPrefix(), hash)
+	hash := hashNode(encoded)
+	cacheKey := fmt.Sprintf("%s/%s", q.persist.NodeURLPrefix(), hash)
 	if cache != nil {
 		if cache.Contains(cacheKey) {
 			return hash, nil
 		}
 	}
-	storeQ <- func() error {
-		err = persist.Store(ctx, hash, encoded)
-		if err != nil {
-			return fmt.Errorf("persist store: %w", err)
-		}
+	q.store(ctx, hash, encoded, func() {
 		if cache != nil {
-			cache.Add(cacheKey, node)
+			addToCache(cache, cacheKey, node, len(encoded))
+			if bc, ok := cache.(bytesCache); ok {
+				bc.addBytes(cacheKey, encoded)
+			}
 		}
-		return nil
-	}
+	})
 	if node.dirty && node.source != nil && *node.source != hash {
 		fmt.Printf("expected node %s %v\n", *node.source, node.expected)
 		fmt.Printf("found    node %s %v\n", hash, node)
@@ -267,3 +396,9 @@ func (node *mastNode) store(
 	node.shared = true
 	return hash, nil
 }
+
+// hashNode returns the name a node with the given serialized bytes is persisted as.
+func hashNode(encoded []byte) string {
+	hashBytes := blake2b.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(hashBytes[:])
+}
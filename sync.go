@@ -0,0 +1,277 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultSyncConcurrency is how many loads and stores Sync does at once, unless told otherwise.
+const DefaultSyncConcurrency = 40
+
+// SyncOptions controls Sync.
+type SyncOptions struct {
+	// Concurrency is how many loads and stores may be in flight at once. 0 means use
+	// DefaultSyncConcurrency. Memory use is proportional to it, since each worker holds a
+	// path of nodes waiting for their subtrees to be copied.
+	Concurrency int
+	// Progress, if set, is invoked with the running totals after each node is checked.
+	// Invocations are not concurrent.
+	Progress func(SyncProgress)
+	// Unmarshal is used to find the links in nodes in the V1Marshaler format; defaults to JSON.
+	Unmarshal func([]byte, interface{}) error
+}
+
+// SyncProgress counts what Sync has done.
+type SyncProgress struct {
+	// Checked is the number of nodes looked for in the destination.
+	Checked int
+	// Copied is the number of nodes that were missing and copied.
+	Copied int
+	// Bytes is the size of the nodes copied.
+	Bytes int64
+}
+
+// Sync copies the nodes of the given root that are missing from one Persist to another.
+// Only subtrees whose nodes are missing from the destination are visited, since a node being
+// present implies the rest of its subtree is too. Nodes are stored after their children, so
+// that the destination never has dangling links, even if Sync fails partway.
+func Sync(ctx context.Context, root *Root, from, to Persist, options *SyncOptions) (*SyncProgress, error) {
+	if options == nil {
+		options = &SyncOptions{}
+	}
+	concurrency := options.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultSyncConcurrency
+	}
+	unmarshal := options.Unmarshal
+	if unmarshal == nil {
+		unmarshal = defaultUnmarshal
+	}
+	var nf nodeFormat
+	switch root.NodeFormat {
+	case string(V115Binary), string(V115BinaryCounted):
+		nf = nodeFormat(root.NodeFormat)
+	case "", string(V1Marshaler):
+		nf = V1Marshaler
+	default:
+		return nil, fmt.Errorf("unknown node format: %s", root.NodeFormat)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := syncer{
+		from:       from,
+		to:         to,
+		nodeFormat: nf,
+		unmarshal:  unmarshal,
+		onProgress: options.Progress,
+		cancel:     cancel,
+	}
+	if root.Link != nil {
+		err := s.run(ctx, *root.Link, concurrency)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &s.progress, nil
+}
+
+// syncer visits nodes with a fixed number of workers, taking the most recently found node
+// next, so that the nodes held in memory while waiting for their children to be copied are
+// mostly along the paths being explored.
+type syncer struct {
+	from, to   Persist
+	nodeFormat nodeFormat
+	unmarshal  func([]byte, interface{}) error
+	onProgress func(SyncProgress)
+	cancel     func()
+	l          sync.Mutex
+	cond       *sync.Cond
+	// todo has the nodes found but not yet visited.
+	todo []*syncNode
+	done bool
+	err  error
+	// pl guards progress.
+	pl       sync.Mutex
+	progress SyncProgress
+}
+
+// syncNode is a node being synced.
+type syncNode struct {
+	name   string
+	parent *syncNode
+	// nodeBytes and pending are set for nodes waiting for their children to be copied.
+	nodeBytes []byte
+	pending   int
+}
+
+// run copies the named node and its subtree, if missing from the destination, with the
+// given number of workers.
+func (s *syncer) run(ctx context.Context, name string, workers int) error {
+	s.cond = sync.NewCond(&s.l)
+	s.todo = []*syncNode{{name: name}}
+	stop := context.AfterFunc(ctx, func() { s.finish(ctx.Err()) })
+	defer stop()
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := s.next(); n != nil; n = s.next() {
+				err := s.visit(ctx, n)
+				if err != nil {
+					s.finish(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return s.err
+}
+
+// next returns the next node to visit, waiting for one if needed, or nil once syncing is
+// finished.
+func (s *syncer) next() *syncNode {
+	s.l.Lock()
+	defer s.l.Unlock()
+	for len(s.todo) == 0 && !s.done {
+		s.cond.Wait()
+	}
+	if s.done {
+		return nil
+	}
+	n := s.todo[len(s.todo)-1]
+	s.todo = s.todo[:len(s.todo)-1]
+	return n
+}
+
+// finish stops syncing, with the given error, if it hasn't stopped already.
+func (s *syncer) finish(err error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.done {
+		return
+	}
+	s.done = true
+	s.err = err
+	if err != nil {
+		s.cancel()
+	}
+	s.cond.Broadcast()
+}
+
+// visit copies the given node, if missing from the destination, once its children are.
+func (s *syncer) visit(ctx context.Context, n *syncNode) error {
+	exists, err := s.exists(ctx, n.name)
+	if err != nil {
+		return fmt.Errorf("exists %s: %w", n.name, err)
+	}
+	if exists {
+		s.report(0)
+		return s.synced(ctx, n.parent)
+	}
+	nodeBytes, err := s.from.Load(ctx, n.name)
+	if err != nil {
+		return fmt.Errorf("persist load %s: %w", n.name, err)
+	}
+	links, err := nodeLinks(s.nodeFormat, nodeBytes, s.unmarshal)
+	if err != nil {
+		return fmt.Errorf("links of %s: %w", n.name, err)
+	}
+	n.nodeBytes = nodeBytes
+	if len(links) == 0 {
+		return s.store(ctx, n)
+	}
+	s.l.Lock()
+	n.pending = len(links)
+	for _, link := range links {
+		s.todo = append(s.todo, &syncNode{name: link, parent: n})
+	}
+	s.cond.Broadcast()
+	s.l.Unlock()
+	return nil
+}
+
+// store copies the given node, whose children have been copied.
+func (s *syncer) store(ctx context.Context, n *syncNode) error {
+	err := s.to.Store(ctx, n.name, n.nodeBytes)
+	if err != nil {
+		return fmt.Errorf("persist store %s: %w", n.name, err)
+	}
+	s.report(len(n.nodeBytes))
+	n.nodeBytes = nil
+	return s.synced(ctx, n.parent)
+}
+
+// synced notes that a child of the given node is in the destination, copying the node if
+// it was the last one. A nil node means the root is, so syncing is finished.
+func (s *syncer) synced(ctx context.Context, parent *syncNode) error {
+	if parent == nil {
+		s.finish(nil)
+		return nil
+	}
+	s.l.Lock()
+	parent.pending--
+	ready := parent.pending == 0
+	s.l.Unlock()
+	if !ready {
+		return nil
+	}
+	return s.store(ctx, parent)
+}
+
+// exists indicates the named node is in the destination.
+func (s *syncer) exists(ctx context.Context, name string) (bool, error) {
+	return WrappedPersist{s.to}.Exists(ctx, name)
+}
+
+// report counts a node as checked, and as copied if it had the given number of bytes.
+func (s *syncer) report(copiedBytes int) {
+	s.pl.Lock()
+	defer s.pl.Unlock()
+	s.progress.Checked++
+	if copiedBytes > 0 {
+		s.progress.Copied++
+		s.progress.Bytes += int64(copiedBytes)
+	}
+	if s.onProgress != nil {
+		s.onProgress(s.progress)
+	}
+}
+
+// nodeLinks returns the names of the nodes linked from the given serialized node, without
+// needing to know the types of its keys and values.
+func nodeLinks(nf nodeFormat, nodeBytes []byte, unmarshal func([]byte, interface{}) error) ([]string, error) {
+	var links []string
+	switch nf {
+	case V1Marshaler:
+		var node struct {
+			Link []string
+		}
+		err := unmarshal(nodeBytes, &node)
+		if err != nil {
+			return nil, err
+		}
+		links = node.Link
+	case V115Binary, V115BinaryCounted:
+		var node mastNode
+		_, err := decodeMastNode(&Mast{}, nodeBytes, &node)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range node.Link {
+			if link != nil {
+				links = append(links, link.(string))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown node format '%v'", nf)
+	}
+	res := links[:0]
+	for _, link := range links {
+		if link != "" {
+			res = append(res, link)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,181 @@
+package mast
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	t.Parallel()
+	for _, nf := range []nodeFormat{V1Marshaler, V115Binary, V115BinaryCounted} {
+		from := NewInMemoryStore()
+		to := NewInMemoryStore()
+		fromConfig := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: from}
+		toConfig := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: to}
+		m, err := NewRoot(&CreateRemoteOptions{NodeFormat: nf}).LoadMast(ctx, &fromConfig)
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, m.Insert(ctx, i, i))
+		}
+		root, err := m.MakeRoot(ctx)
+		require.NoError(t, err)
+
+		var lastProgress SyncProgress
+		progress, err := Sync(ctx, root, from, to, &SyncOptions{
+			Progress: func(p SyncProgress) { lastProgress = p },
+		})
+		require.NoError(t, err)
+		require.Equal(t, *progress, lastProgress)
+		require.Equal(t, progress.Checked, progress.Copied)
+		require.Len(t, storedNames(t, to), progress.Copied)
+		report, err := Verify(ctx, root, &toConfig)
+		require.NoError(t, err)
+		require.True(t, report.OK(), "%s: %v", nf, report.Problems)
+
+		// only the changed path is copied the second time
+		require.NoError(t, m.Insert(ctx, 500, -1))
+		root, err = m.MakeRoot(ctx)
+		require.NoError(t, err)
+		progress2, err := Sync(ctx, root, from, to, nil)
+		require.NoError(t, err)
+		require.Equal(t, int(m.Height())+1, progress2.Copied)
+		require.Less(t, progress2.Checked, progress.Checked)
+		report, err = Verify(ctx, root, &toConfig)
+		require.NoError(t, err)
+		require.True(t, report.OK(), "%s: %v", nf, report.Problems)
+	}
+}
+
+type failingStore struct {
+	Persist
+	l         sync.Mutex
+	remaining int
+}
+
+func (fs *failingStore) Store(ctx context.Context, name string, b []byte) error {
+	fs.l.Lock()
+	defer fs.l.Unlock()
+	if fs.remaining == 0 {
+		return errors.New("out of space")
+	}
+	fs.remaining--
+	return fs.Persist.Store(ctx, name, b)
+}
+
+func TestSyncNeverLeavesDanglingLinks(t *testing.T) {
+	t.Parallel()
+	from := NewInMemoryStore()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: from}
+	m, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+
+	to := &failingStore{Persist: NewInMemoryStore(), remaining: 20}
+	_, err = Sync(ctx, root, from, to, &SyncOptions{Concurrency: 3})
+	require.Error(t, err)
+	stored := storedNames(t, to.Persist)
+	require.NotEmpty(t, stored)
+	for name := range stored {
+		b, err := to.Load(ctx, name)
+		require.NoError(t, err)
+		links, err := nodeLinks(V115Binary, b, nil)
+		require.NoError(t, err)
+		for _, link := range links {
+			require.True(t, stored[link], "%s links to missing %s", name, link)
+		}
+	}
+}
+
+// brokenLoadStore fails every load, and, lacking Exists, makes Sync load to check for nodes.
+type brokenLoadStore struct {
+	Persist
+}
+
+func (brokenLoadStore) Load(context.Context, string) ([]byte, error) {
+	return nil, errors.New("permission denied")
+}
+
+// inFlightStore records the most loads and stores it has had in flight at once.
+type inFlightStore struct {
+	Persist
+	l                  sync.Mutex
+	inFlight, maxSoFar int
+}
+
+func (s *inFlightStore) track() func() {
+	s.l.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxSoFar {
+		s.maxSoFar = s.inFlight
+	}
+	s.l.Unlock()
+	time.Sleep(100 * time.Microsecond)
+	return func() {
+		s.l.Lock()
+		s.inFlight--
+		s.l.Unlock()
+	}
+}
+
+func (s *inFlightStore) Load(ctx context.Context, name string) ([]byte, error) {
+	defer s.track()()
+	return s.Persist.Load(ctx, name)
+}
+
+func (s *inFlightStore) Store(ctx context.Context, name string, b []byte) error {
+	defer s.track()()
+	return s.Persist.Store(ctx, name, b)
+}
+
+func TestSyncErrors(t *testing.T) {
+	t.Parallel()
+	from := NewInMemoryStore()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: from}
+	m, err := NewRoot(nil).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+
+	to := brokenLoadStore{NewInMemoryStore()}
+	_, err = Sync(ctx, root, from, to, nil)
+	require.ErrorContains(t, err, "permission denied")
+	require.Empty(t, storedNames(t, to.Persist))
+
+	// without Exists, not-found loads mean nodes are missing
+	_, err = Sync(ctx, root, from, struct{ Persist }{to.Persist}, nil)
+	require.NoError(t, err)
+	report, err := Verify(ctx, root, &RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: to.Persist})
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%v", report.Problems)
+}
+
+func TestSyncConcurrency(t *testing.T) {
+	t.Parallel()
+	from := NewInMemoryStore()
+	config := RemoteConfig{KeysLike: 1, ValuesLike: 1, StoreImmutablePartsWith: from}
+	m, err := NewRoot(&CreateRemoteOptions{BranchFactor: 4}).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, i))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+
+	store := &inFlightStore{Persist: NewInMemoryStore()}
+	_, err = Sync(ctx, root, &inFlightStore{Persist: from}, store, &SyncOptions{Concurrency: 3})
+	require.NoError(t, err)
+	require.Greater(t, store.maxSoFar, 1)
+	require.LessOrEqual(t, store.maxSoFar, 3)
+}
@@ -0,0 +1,335 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Typed is a type-safe facade for a Mast whose keys are all of type K and values are all of
+// type V. Entries of other types are reported as errors rather than causing panics.
+type Typed[K, V any] struct {
+	m *Mast
+}
+
+// TypedDiff is a Diff with concrete key and value types.
+type TypedDiff[K, V any] struct {
+	Key      K
+	Type     DiffType
+	OldValue V
+	NewValue V
+}
+
+// TypedDiffCursor iterates through the differences between two Typed trees.
+type TypedDiffCursor[K, V any] struct {
+	dc *DiffCursor
+}
+
+// TypedCursor can be used to seek around a Typed tree.
+type TypedCursor[K, V any] struct {
+	c *Cursor
+}
+
+// NewTyped wraps the given tree, which should only contain keys of type K and values of type V.
+func NewTyped[K, V any](m *Mast) *Typed[K, V] {
+	return &Typed[K, V]{m}
+}
+
+// NewTypedInMemory returns a new Typed tree for use as an in-memory data structure.
+func NewTypedInMemory[K, V any]() *Typed[K, V] {
+	m := NewInMemory()
+	return &Typed[K, V]{&m}
+}
+
+// LoadTyped loads a Typed tree from a remote store, like Root.LoadMast. KeysLike and
+// ValuesLike are derived from K and V if not already set in the config.
+func LoadTyped[K, V any](ctx context.Context, root *Root, config *RemoteConfig) (*Typed[K, V], error) {
+	m, err := root.LoadMast(ctx, TypedRemoteConfig[K, V](config))
+	if err != nil {
+		return nil, err
+	}
+	return &Typed[K, V]{m}, nil
+}
+
+// TypedRemoteConfig returns a copy of the given config with KeysLike and ValuesLike set to
+// the zero values of K and V, unless they were already set.
+func TypedRemoteConfig[K, V any](config *RemoteConfig) *RemoteConfig {
+	var c RemoteConfig
+	if config != nil {
+		c = *config
+	}
+	if c.KeysLike == nil {
+		var k K
+		c.KeysLike = k
+	}
+	if c.ValuesLike == nil {
+		var v V
+		c.ValuesLike = v
+	}
+	return &c
+}
+
+// Mast returns the underlying tree.
+func (t *Typed[K, V]) Mast() *Mast {
+	return t.m
+}
+
+// Get returns the value of the entry with the given key, or !ok if the tree doesn't contain the given key.
+func (t *Typed[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	var zero V
+	var value interface{}
+	ok, err := t.m.Get(ctx, key, &value)
+	if err != nil || !ok {
+		return zero, ok, err
+	}
+	v, err := typedAs[V](value)
+	if err != nil {
+		return zero, false, fmt.Errorf("value: %w", err)
+	}
+	return v, true, nil
+}
+
+// Insert adds or replaces the value for the given key.
+func (t *Typed[K, V]) Insert(ctx context.Context, key K, value V) error {
+	return t.m.Insert(ctx, key, value)
+}
+
+// Delete deletes the entry with given key and value from the tree.
+func (t *Typed[K, V]) Delete(ctx context.Context, key K, value V) error {
+	return t.m.Delete(ctx, key, value)
+}
+
+// DeleteKey deletes the entry with the given key, whatever its value, returning whether
+// there was one, and its value.
+func (t *Typed[K, V]) DeleteKey(ctx context.Context, key K) (bool, V, error) {
+	var zero V
+	existed, value, err := t.m.DeleteKey(ctx, key)
+	if err != nil || !existed {
+		return existed, zero, err
+	}
+	v, err := typedAs[V](value)
+	if err != nil {
+		return true, zero, fmt.Errorf("value: %w", err)
+	}
+	return true, v, nil
+}
+
+// DeleteIf deletes the entry with the given key if the given predicate is true for its
+// value, returning whether it was deleted.
+func (t *Typed[K, V]) DeleteIf(ctx context.Context, key K, pred func(V) bool) (bool, error) {
+	var deleted bool
+	_, _, err := t.m.deleteIf(ctx, key, func(value interface{}) (bool, error) {
+		v, err := typedAs[V](value)
+		if err != nil {
+			return false, fmt.Errorf("value: %w", err)
+		}
+		deleted = pred(v)
+		return deleted, nil
+	})
+	return deleted && err == nil, err
+}
+
+// InsertIfAbsent adds the given entry if the tree doesn't already have the key, returning
+// whether it was added.
+func (t *Typed[K, V]) InsertIfAbsent(ctx context.Context, key K, value V) (bool, error) {
+	return t.m.InsertIfAbsent(ctx, key, value)
+}
+
+// Replace sets the value for the given key only if the tree already has the key, returning
+// whether it did, and the previous value.
+func (t *Typed[K, V]) Replace(ctx context.Context, key K, value V) (bool, V, error) {
+	var zero V
+	replaced, old, err := t.m.Replace(ctx, key, value)
+	if err != nil || !replaced {
+		return replaced, zero, err
+	}
+	v, err := typedAs[V](old)
+	if err != nil {
+		return true, zero, fmt.Errorf("value: %w", err)
+	}
+	return true, v, nil
+}
+
+// CompareAndSet sets the value for the given key only if the tree has the key with a value
+// equal to old, returning whether it did.
+func (t *Typed[K, V]) CompareAndSet(ctx context.Context, key K, old, new V) (bool, error) {
+	return t.m.CompareAndSet(ctx, key, old, new)
+}
+
+// Iter iterates over the entries of a tree, invoking the given callback for every entry's key and value.
+func (t *Typed[K, V]) Iter(ctx context.Context, f func(K, V) error) error {
+	return t.m.Iter(ctx, typedEntryCallback(f))
+}
+
+// SeekIter is like Iter, but starts at the first key greater than or equal to the given one.
+func (t *Typed[K, V]) SeekIter(ctx context.Context, key K, f func(K, V) error) error {
+	return t.m.SeekIter(ctx, key, typedEntryCallback(f))
+}
+
+// DiffIter invokes the given callback for every entry that is different from the given tree,
+// like Mast.DiffIter.
+func (t *Typed[K, V]) DiffIter(
+	ctx context.Context,
+	old *Typed[K, V],
+	f func(added, removed bool, key K, addedValue, removedValue V) (bool, error),
+) error {
+	return t.m.DiffIter(ctx, old.m,
+		func(added, removed bool, key, addedValue, removedValue interface{}) (bool, error) {
+			k, err := typedAs[K](key)
+			if err != nil {
+				return false, fmt.Errorf("key: %w", err)
+			}
+			av, err := typedAs[V](addedValue)
+			if err != nil {
+				return false, fmt.Errorf("added value: %w", err)
+			}
+			rv, err := typedAs[V](removedValue)
+			if err != nil {
+				return false, fmt.Errorf("removed value: %w", err)
+			}
+			return f(added, removed, k, av, rv)
+		})
+}
+
+// StartDiff returns a cursor for iterating through the differences from the given tree.
+func (t *Typed[K, V]) StartDiff(ctx context.Context, old *Typed[K, V]) (*TypedDiffCursor[K, V], error) {
+	var oldMast *Mast
+	if old != nil {
+		oldMast = old.m
+	}
+	dc, err := t.m.StartDiff(ctx, oldMast)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedDiffCursor[K, V]{dc}, nil
+}
+
+// Cursor obtains a cursor set to the smallest value in the root node.
+func (t *Typed[K, V]) Cursor(ctx context.Context) (*TypedCursor[K, V], error) {
+	c, err := t.m.Cursor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedCursor[K, V]{c}, nil
+}
+
+// Clone returns a new tree that shares all the source's data but can evolve independently.
+func (t *Typed[K, V]) Clone(ctx context.Context) (*Typed[K, V], error) {
+	m, err := t.m.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Typed[K, V]{&m}, nil
+}
+
+// MakeRoot makes a new persistent root, after ensuring all the changed nodes
+// have been written to the persistent store.
+func (t *Typed[K, V]) MakeRoot(ctx context.Context) (*Root, error) {
+	return t.m.MakeRoot(ctx)
+}
+
+// Size returns the number of entries in the tree.
+func (t *Typed[K, V]) Size() uint64 {
+	return t.m.Size()
+}
+
+// Height returns the number of levels between the leaves and root.
+func (t *Typed[K, V]) Height() uint8 {
+	return t.m.Height()
+}
+
+// NextEntry returns the next difference, or ErrNoMoreDiffs.
+func (tdc *TypedDiffCursor[K, V]) NextEntry(ctx context.Context) (TypedDiff[K, V], error) {
+	d, err := tdc.dc.NextEntry(ctx)
+	if err != nil {
+		return TypedDiff[K, V]{}, err
+	}
+	var res TypedDiff[K, V]
+	res.Type = d.Type
+	res.Key, err = typedAs[K](d.Key)
+	if err != nil {
+		return TypedDiff[K, V]{}, fmt.Errorf("key: %w", err)
+	}
+	res.OldValue, err = typedAs[V](d.OldValue)
+	if err != nil {
+		return TypedDiff[K, V]{}, fmt.Errorf("old value: %w", err)
+	}
+	res.NewValue, err = typedAs[V](d.NewValue)
+	if err != nil {
+		return TypedDiff[K, V]{}, fmt.Errorf("new value: %w", err)
+	}
+	return res, nil
+}
+
+// Get returns the key and value of the entry at the cursor, if there is an entry,
+// or !ok if there is no entry.
+func (tc *TypedCursor[K, V]) Get() (K, V, bool, error) {
+	var zeroK K
+	var zeroV V
+	key, value, ok := tc.c.Get()
+	if !ok {
+		return zeroK, zeroV, false, nil
+	}
+	k, err := typedAs[K](key)
+	if err != nil {
+		return zeroK, zeroV, false, fmt.Errorf("key: %w", err)
+	}
+	v, err := typedAs[V](value)
+	if err != nil {
+		return zeroK, zeroV, false, fmt.Errorf("value: %w", err)
+	}
+	return k, v, true, nil
+}
+
+// Min moves the cursor to the smallest key in the subtree under the current position.
+func (tc *TypedCursor[K, V]) Min(ctx context.Context) error {
+	return tc.c.Min(ctx)
+}
+
+// Max moves the cursor to the largest key in the subtree under the current position.
+func (tc *TypedCursor[K, V]) Max(ctx context.Context) error {
+	return tc.c.Max(ctx)
+}
+
+// Forward moves the cursor to the entry with the next-larger key.
+func (tc *TypedCursor[K, V]) Forward(ctx context.Context) error {
+	return tc.c.Forward(ctx)
+}
+
+// Backward moves the cursor to the entry with the next-smaller key.
+func (tc *TypedCursor[K, V]) Backward(ctx context.Context) error {
+	return tc.c.Backward(ctx)
+}
+
+// Ceil moves the cursor to the entry with the given key, or if not present,
+// the entry with the next-larger key.
+func (tc *TypedCursor[K, V]) Ceil(ctx context.Context, key K) error {
+	return tc.c.Ceil(ctx, key)
+}
+
+func typedEntryCallback[K, V any](f func(K, V) error) func(interface{}, interface{}) error {
+	return func(key, value interface{}) error {
+		k, err := typedAs[K](key)
+		if err != nil {
+			return fmt.Errorf("key: %w", err)
+		}
+		v, err := typedAs[V](value)
+		if err != nil {
+			return fmt.Errorf("value: %w", err)
+		}
+		return f(k, v)
+	}
+}
+
+// typedAs converts an entry's key or value to T; nil converts to T's zero value.
+func typedAs[T any](i interface{}) (T, error) {
+	var zero T
+	if i == nil {
+		return zero, nil
+	}
+	t, ok := i.(T)
+	if !ok {
+		return zero, fmt.Errorf("expected %v, found %T", reflect.TypeOf(&zero).Elem(), i)
+	}
+	return t, nil
+}
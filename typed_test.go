@@ -0,0 +1,97 @@
+package mast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedRemote(t *testing.T) {
+	t.Parallel()
+	type user struct {
+		Name  string
+		Admin bool
+	}
+	config := RemoteConfig{
+		StoreImmutablePartsWith: NewInMemoryStore(),
+	}
+	m, err := LoadTyped[string, user](ctx, NewRoot(nil), &config)
+	require.NoError(t, err)
+	require.NoError(t, m.Insert(ctx, "bob", user{"Bob", false}))
+	require.NoError(t, m.Insert(ctx, "alice", user{"Alice", true}))
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+
+	v1, err := LoadTyped[string, user](ctx, root, &config)
+	require.NoError(t, err)
+	u, ok, err := v1.Get(ctx, "alice")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, user{"Alice", true}, u)
+	_, ok, err = v1.Get(ctx, "carol")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	var names []string
+	require.NoError(t, v1.Iter(ctx, func(k string, v user) error {
+		names = append(names, v.Name)
+		return nil
+	}))
+	require.Equal(t, []string{"Alice", "Bob"}, names)
+
+	v2, err := v1.Clone(ctx)
+	require.NoError(t, err)
+	require.NoError(t, v2.Insert(ctx, "bob", user{"Bob", true}))
+	require.NoError(t, v2.Delete(ctx, "alice", user{"Alice", true}))
+	dc, err := v2.StartDiff(ctx, v1)
+	require.NoError(t, err)
+	d, err := dc.NextEntry(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TypedDiff[string, user]{
+		Key:      "alice",
+		Type:     DiffType_Remove,
+		OldValue: user{"Alice", true},
+	}, d)
+	d, err = dc.NextEntry(ctx)
+	require.NoError(t, err)
+	require.Equal(t, TypedDiff[string, user]{
+		Key:      "bob",
+		Type:     DiffType_Change,
+		OldValue: user{"Bob", false},
+		NewValue: user{"Bob", true},
+	}, d)
+	_, err = dc.NextEntry(ctx)
+	require.Equal(t, ErrNoMoreDiffs, err)
+}
+
+func TestTypedCursor(t *testing.T) {
+	t.Parallel()
+	m := NewTypedInMemory[int, string]()
+	for i := 0; i < 100; i += 10 {
+		require.NoError(t, m.Insert(ctx, i, "v"))
+	}
+	c, err := m.Cursor(ctx)
+	require.NoError(t, err)
+	require.NoError(t, c.Ceil(ctx, 15))
+	k, v, ok, err := c.Get()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 20, k)
+	require.Equal(t, "v", v)
+	require.NoError(t, c.Forward(ctx))
+	k, _, _, err = c.Get()
+	require.NoError(t, err)
+	require.Equal(t, 30, k)
+}
+
+func TestTypedReportsWrongTypes(t *testing.T) {
+	t.Parallel()
+	m := NewInMemory()
+	require.NoError(t, m.Insert(ctx, 1, "one"))
+	require.NoError(t, m.Insert(ctx, 2, 2))
+	typed := NewTyped[int, string](&m)
+	_, _, err := typed.Get(ctx, 2)
+	require.EqualError(t, err, "value: expected string, found int")
+	err = typed.Iter(ctx, func(int, string) error { return nil })
+	require.EqualError(t, err, "value: expected string, found int")
+}
@@ -0,0 +1,90 @@
+package mast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultUpdateAttempts is how many times Update tries its mutation, unless told otherwise.
+const DefaultUpdateAttempts = 10
+
+// UpdateOptions controls Update.
+type UpdateOptions struct {
+	// MaxAttempts is how many times the mutation is tried before giving up with
+	// ErrRootConflict. 0 means use DefaultUpdateAttempts; negative values are an error.
+	MaxAttempts int
+	// Backoff is how long to wait after the first conflict; it doubles after each one.
+	Backoff time.Duration
+	// CreateRemoteOptions is used to create the root, if the RootStore doesn't have one yet.
+	CreateRemoteOptions *CreateRemoteOptions
+}
+
+// Update applies the given mutation to the tree at the named root in the RootStore, and
+// swaps in the resulting root. If someone else changes the root in the meantime, the
+// mutation is applied again to their version, so it should only depend on the tree it is
+// given. Returns the new root, or the current one if the mutation changed nothing.
+func Update(
+	ctx context.Context,
+	rs RootStore,
+	name string,
+	config *RemoteConfig,
+	f func(*Mast) error,
+	options *UpdateOptions,
+) (*Root, error) {
+	if options == nil {
+		options = &UpdateOptions{}
+	}
+	attempts := options.MaxAttempts
+	if attempts < 0 {
+		return nil, fmt.Errorf("negative MaxAttempts %d", attempts)
+	}
+	if attempts == 0 {
+		attempts = DefaultUpdateAttempts
+	}
+	backoff := options.Backoff
+	for attempt := 1; ; attempt++ {
+		old, err := rs.Get(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("get root: %w", err)
+		}
+		base := old
+		if base == nil {
+			base = NewRoot(options.CreateRemoteOptions)
+		}
+		m, err := base.LoadMast(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("load: %w", err)
+		}
+		err = f(m)
+		if err != nil {
+			return nil, fmt.Errorf("mutate: %w", err)
+		}
+		newRoot, err := m.MakeRoot(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("make root: %w", err)
+		}
+		if old != nil && newRoot.Equal(old) {
+			return old, nil
+		}
+		err = rs.CompareAndSwap(ctx, name, old, newRoot)
+		if err == nil {
+			return newRoot, nil
+		}
+		if !errors.Is(err, ErrRootConflict) {
+			return nil, fmt.Errorf("swap root: %w", err)
+		}
+		if attempt == attempts {
+			return nil, fmt.Errorf("after %d attempts: %w", attempts, err)
+		}
+		if backoff > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package mast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+	rs := NewInMemoryRootStore()
+	config := RemoteConfig{
+		KeysLike:                "",
+		ValuesLike:              1,
+		StoreImmutablePartsWith: NewInMemoryStore(),
+	}
+	increment := func(m *Mast) error {
+		var count int
+		_, err := m.Get(ctx, "count", &count)
+		if err != nil {
+			return err
+		}
+		return m.Insert(ctx, "count", count+1)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := Update(ctx, rs, "main", &config, increment, &UpdateOptions{MaxAttempts: 1000})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	root, err := rs.Get(ctx, "main")
+	require.NoError(t, err)
+	m, err := root.LoadMast(ctx, &config)
+	require.NoError(t, err)
+	var count int
+	found, err := m.Get(ctx, "count", &count)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 80, count)
+
+	unchanged, err := Update(ctx, rs, "main", &config, func(*Mast) error { return nil }, nil)
+	require.NoError(t, err)
+	require.True(t, unchanged.Equal(root))
+
+	failure := errors.New("failure")
+	_, err = Update(ctx, rs, "main", &config, func(*Mast) error { return failure }, nil)
+	require.ErrorIs(t, err, failure)
+}
+
+// conflictingRootStore always conflicts, wrapping ErrRootConflict as a RootStore with a
+// remote backend might.
+type conflictingRootStore struct {
+	RootStore
+}
+
+func (conflictingRootStore) CompareAndSwap(_ context.Context, name string, _, _ *Root) error {
+	return fmt.Errorf("swap %s: %w", name, ErrRootConflict)
+}
+
+func TestUpdateGivesUp(t *testing.T) {
+	t.Parallel()
+	config := RemoteConfig{
+		KeysLike:                "",
+		ValuesLike:              1,
+		StoreImmutablePartsWith: NewInMemoryStore(),
+	}
+	attempts := 0
+	_, err := Update(ctx, conflictingRootStore{NewInMemoryRootStore()}, "main", &config, func(m *Mast) error {
+		attempts++
+		return m.Insert(ctx, "a", 1)
+	}, &UpdateOptions{MaxAttempts: 3})
+	require.ErrorIs(t, err, ErrRootConflict)
+	require.Equal(t, 3, attempts)
+
+	_, err = Update(ctx, conflictingRootStore{NewInMemoryRootStore()}, "main", &config, func(m *Mast) error {
+		attempts++
+		return nil
+	}, &UpdateOptions{MaxAttempts: -1})
+	require.Error(t, err)
+	require.Equal(t, 3, attempts)
+}
@@ -0,0 +1,166 @@
+package mast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// VerifyProblem describes an inconsistency found by Verify.
+type VerifyProblem struct {
+	// Node is the name of the node with the problem, or empty for problems with the Root.
+	Node string
+	// Message describes the problem.
+	Message string
+}
+
+func (p VerifyProblem) String() string {
+	if p.Node == "" {
+		return fmt.Sprintf("root: %s", p.Message)
+	}
+	return fmt.Sprintf("node %s: %s", p.Node, p.Message)
+}
+
+// VerifyReport summarizes what Verify checked and found.
+type VerifyReport struct {
+	// Nodes is the number of nodes checked.
+	Nodes int
+	// Entries is the number of entries found in the nodes that could be checked.
+	Entries uint64
+	// Problems lists every inconsistency found.
+	Problems []VerifyProblem
+}
+
+// OK indicates that no problems were found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *VerifyReport) addProblem(node string, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, VerifyProblem{node, fmt.Sprintf(format, args...)})
+}
+
+// Verify loads every node reachable from the given root and checks that its bytes hash to
+// its name, that keys are ordered within and across nodes, that key layers agree with node
+// heights, that links and keys are consistent, and that the entries add up to Root.Size.
+// Problems with the tree are described in the returned report rather than returned as errors;
+// an error means the tree could not be checked at all.
+func Verify(ctx context.Context, root *Root, config *RemoteConfig) (*VerifyReport, error) {
+	if config.StoreImmutablePartsWith == nil {
+		return nil, errors.New("no persistence mechanism set; set RemoteConfig.StoreImmutablePartsWith")
+	}
+	if !config.UnmarshalerUsesRegisteredTypes && (config.KeysLike == nil || config.ValuesLike == nil) {
+		return nil, errors.New("will not be able to figure out which type to unmarshal entries as; set RemoteConfig.{Keys,Values}Like or UnmarshalerUsesRegisteredTypes")
+	}
+	m, err := root.newMast(config)
+	if err != nil {
+		return nil, err
+	}
+	report := VerifyReport{}
+	if root.BranchFactor == 0 {
+		report.addProblem("", "branch factor is 0")
+		return &report, nil
+	}
+	if root.Link != nil {
+		report.Entries = m.verifyNode(ctx, *root.Link, m.height, true, nil, nil, &report)
+	}
+	if report.Entries != root.Size {
+		report.addProblem("", "size is %d but found %d entries", root.Size, report.Entries)
+	}
+	return &report, nil
+}
+
+// verifyNode checks the named node, whose keys must be between lo and hi (exclusive, nil
+// meaning unbounded), and its subtree. It returns the number of entries found.
+func (m *Mast) verifyNode(
+	ctx context.Context,
+	name string,
+	height uint8,
+	isRoot bool,
+	lo, hi interface{},
+	report *VerifyReport,
+) uint64 {
+	report.Nodes++
+	nodeBytes, err := m.persist.Load(ctx, name)
+	if err != nil {
+		report.addProblem(name, "load: %v", err)
+		return 0
+	}
+	if hash := hashNode(nodeBytes); hash != name {
+		report.addProblem(name, "content hashes to %s", hash)
+	}
+	node, err := m.decodeNode(nodeBytes, name)
+	if err != nil {
+		report.addProblem(name, "decode: %v", err)
+		return 0
+	}
+	if len(node.Value) != len(node.Key) || len(node.Link) != len(node.Key)+1 {
+		report.addProblem(name, "has %d keys, %d values and %d links", len(node.Key), len(node.Value), len(node.Link))
+		return 0
+	}
+	if !isRoot && node.isEmpty() {
+		report.addProblem(name, "is empty")
+	}
+	for i, key := range node.Key {
+		var prev interface{}
+		if i > 0 {
+			prev = node.Key[i-1]
+		} else {
+			prev = lo
+		}
+		if prev != nil {
+			cmp, err := m.keyOrder(prev, key)
+			if err != nil {
+				report.addProblem(name, "compare key[%d]: %v", i, err)
+			} else if cmp >= 0 {
+				report.addProblem(name, "key[%d] %v is not greater than %v", i, key, prev)
+			}
+		}
+		if hi != nil && i == len(node.Key)-1 {
+			cmp, err := m.keyOrder(key, hi)
+			if err != nil {
+				report.addProblem(name, "compare key[%d]: %v", i, err)
+			} else if cmp >= 0 {
+				report.addProblem(name, "key[%d] %v is not less than %v", i, key, hi)
+			}
+		}
+		layer, err := m.keyLayer(key, m.branchFactor)
+		if err != nil {
+			report.addProblem(name, "layer of key[%d]: %v", i, err)
+		} else if layer < height || !isRoot && layer != height {
+			report.addProblem(name, "key[%d] %v has layer %d but is at height %d", i, key, layer, height)
+		}
+	}
+
+	entries := uint64(len(node.Key))
+	for i, link := range node.Link {
+		if link == nil {
+			if node.linkCount != nil && node.linkCount[i] != 0 {
+				report.addProblem(name, "link[%d] is empty but counted %d entries", i, node.linkCount[i])
+			}
+			continue
+		}
+		if height == 0 {
+			report.addProblem(name, "link[%d] is below height 0", i)
+			continue
+		}
+		childLo, childHi := lo, hi
+		if i > 0 {
+			childLo = node.Key[i-1]
+		}
+		if i < len(node.Key) {
+			childHi = node.Key[i]
+		}
+		childName, ok := link.(string)
+		if !ok {
+			report.addProblem(name, "link[%d] has type %T", i, link)
+			continue
+		}
+		n := m.verifyNode(ctx, childName, height-1, false, childLo, childHi, report)
+		if node.linkCount != nil && node.linkCount[i] != n {
+			report.addProblem(name, "link[%d] has %d entries but counted %d", i, n, node.linkCount[i])
+		}
+		entries += n
+	}
+	return entries
+}
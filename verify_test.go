@@ -0,0 +1,87 @@
+package mast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeVerifyTree(t *testing.T, nf nodeFormat) (*Root, *RemoteConfig) {
+	config := RemoteConfig{
+		KeysLike:                1,
+		ValuesLike:              "",
+		StoreImmutablePartsWith: NewInMemoryStore(),
+	}
+	m, err := NewRoot(&CreateRemoteOptions{NodeFormat: nf}).LoadMast(ctx, &config)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, m.Insert(ctx, i, "v"))
+	}
+	root, err := m.MakeRoot(ctx)
+	require.NoError(t, err)
+	return root, &config
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	for _, nf := range []nodeFormat{V1Marshaler, V115Binary, V115BinaryCounted} {
+		root, config := makeVerifyTree(t, nf)
+		report, err := Verify(ctx, root, config)
+		require.NoError(t, err)
+		require.True(t, report.OK(), "%s: %v", nf, report.Problems)
+		require.Equal(t, uint64(1000), report.Entries)
+		require.Less(t, 1, report.Nodes)
+	}
+
+	report, err := Verify(ctx, NewRoot(nil), &RemoteConfig{
+		KeysLike:                1,
+		ValuesLike:              "",
+		StoreImmutablePartsWith: NewInMemoryStore(),
+	})
+	require.NoError(t, err)
+	require.True(t, report.OK())
+}
+
+func TestVerifyReportsProblems(t *testing.T) {
+	t.Parallel()
+	root, config := makeVerifyTree(t, V115BinaryCounted)
+	store := config.StoreImmutablePartsWith
+	m, err := root.LoadMast(ctx, config)
+	require.NoError(t, err)
+	rootNode, err := m.load(ctx, m.root)
+	require.NoError(t, err)
+	var children []string
+	for _, link := range rootNode.Link {
+		if link != nil {
+			children = append(children, link.(string))
+		}
+	}
+	require.Less(t, 3, len(children))
+
+	bytes0, err := store.Load(ctx, children[0])
+	require.NoError(t, err)
+	bytes1, err := store.Load(ctx, children[1])
+	require.NoError(t, err)
+	// swap two subtrees, so their names don't match their contents and keys are out of order
+	require.NoError(t, store.Store(ctx, children[0], bytes1))
+	require.NoError(t, store.Store(ctx, children[1], bytes0))
+	// garbage
+	require.NoError(t, store.Store(ctx, children[2], []byte{0xff, 0xff, 0xff}))
+	// missing
+	require.NoError(t, store.(Deleter).Delete(ctx, children[3]))
+	root.Size++
+
+	report, err := Verify(ctx, root, config)
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	problems := map[string][]string{}
+	for _, p := range report.Problems {
+		problems[p.Node] = append(problems[p.Node], p.Message)
+	}
+	require.Contains(t, problems, "")
+	require.Contains(t, problems, children[0])
+	require.Contains(t, problems, children[1])
+	require.Contains(t, problems, children[2])
+	require.Contains(t, problems, children[3])
+	require.Contains(t, problems, *root.Link)
+}
@@ -0,0 +1,53 @@
+package mast
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WrappedPersist is embedded by Persists that wrap another, such as those in persist/cache
+// and persist/compress, to implement Lister, Deleter and Exister by forwarding to the
+// wrapped Persist, so that CollectGarbage and Sync work through them. List and Delete return
+// an error if the wrapped Persist doesn't implement them. Exists loads the item instead, if
+// the wrapped Persist doesn't implement Exister.
+type WrappedPersist struct {
+	Persist
+}
+
+var (
+	_ Lister  = WrappedPersist{}
+	_ Deleter = WrappedPersist{}
+	_ Exister = WrappedPersist{}
+)
+
+// List lists what is stored in the wrapped Persist.
+func (w WrappedPersist) List(ctx context.Context, prefix string, fn func(name string, modified time.Time) error) error {
+	lister, ok := w.Persist.(Lister)
+	if !ok {
+		return fmt.Errorf("%T does not implement mast.Lister", w.Persist)
+	}
+	return lister.List(ctx, prefix, fn)
+}
+
+// Delete deletes the named item from the wrapped Persist.
+func (w WrappedPersist) Delete(ctx context.Context, name string) error {
+	deleter, ok := w.Persist.(Deleter)
+	if !ok {
+		return fmt.Errorf("%T does not implement mast.Deleter", w.Persist)
+	}
+	return deleter.Delete(ctx, name)
+}
+
+// Exists indicates whether the wrapped Persist has the named item. Without Exister, the item
+// is loaded, and only a not-found error means it is missing.
+func (w WrappedPersist) Exists(ctx context.Context, name string) (bool, error) {
+	if exister, ok := w.Persist.(Exister); ok {
+		return exister.Exists(ctx, name)
+	}
+	_, err := w.Persist.Load(ctx, name)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}